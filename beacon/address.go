@@ -0,0 +1,117 @@
+package beacon
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPList is a list of networks, single addresses are matched exactly
+type IPList []netip.Prefix
+
+// ParseIPList parses a comma-separated list of CIDRs and addresses
+func ParseIPList(list string) (IPList, error) {
+	var ret IPList
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %s: %w", entry, err)
+			}
+			ret = append(ret, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %s: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		ret = append(ret, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return ret, nil
+}
+
+// Contains returns true if the address is in one of the networks
+func (l IPList) Contains(addr netip.Addr) bool {
+	// prefixes never contain addresses with a zone
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range l {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIP parses an address, IPv4-mapped IPv6 addresses are returned as IPv4 addresses
+func ParseIP(host string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// RemoteHost returns the address of the client which sent the request. If the request was received from
+// a trusted proxy, the client is the right-most untrusted address in X-Forwarded-For, or X-Real-IP if there
+// is no X-Forwarded-For header. The same client therefore has the same address no matter how many trusted
+// proxies are in front of it. An invalid address ends the search at the last trusted proxy, since the entries
+// left of it can't be attributed to a hop.
+func RemoteHost(r *http.Request, trustedProxies IPList) string {
+	remoteHost := normalizeHost(RemoteAddrHost(r.RemoteAddr))
+	if addr, ok := ParseIP(remoteHost); !ok || !trustedProxies.Contains(addr) {
+		return remoteHost
+	}
+
+	var forwarded []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, host := range strings.Split(value, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				forwarded = append(forwarded, host)
+			}
+		}
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, ok := ParseIP(RemoteAddrHost(forwarded[i]))
+		if !ok {
+			return remoteHost
+		}
+		if !trustedProxies.Contains(addr) {
+			return addr.String()
+		}
+		remoteHost = addr.String()
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); len(forwarded) == 0 && realIP != "" {
+		return normalizeHost(RemoteAddrHost(realIP))
+	}
+	// all addresses are trusted proxies, the left-most is the closest to the client
+	return remoteHost
+}
+
+// RemoteAddrHost returns the host of an address with or without port, e.g. 10.0.0.1:5052, [::1]:5052 or ::1
+func RemoteAddrHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// normalizeHost returns IP addresses in their canonical form, so a client has the same identity on IPv4 and
+// dual-stack listeners. Zones of link-local addresses are kept, they identify different interfaces.
+func normalizeHost(host string) string {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	return addr.Unmap().String()
+}
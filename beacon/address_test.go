@@ -0,0 +1,57 @@
+package beacon
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteHost(t *testing.T) {
+	trusted, err := ParseIPList("10.0.0.0/24, 192.168.1.1, fd00::/64")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		expected   string
+	}{
+		{"direct connection", "172.16.0.5:1234", nil, "", "172.16.0.5"},
+		{"untrusted peer can't set the client address", "172.16.0.5:1234", []string{"1.2.3.4"}, "1.2.3.4", "172.16.0.5"},
+		{"single trusted proxy", "10.0.0.1:1234", []string{"172.16.0.5"}, "", "172.16.0.5"},
+		{"chain of trusted proxies", "10.0.0.1:1234", []string{"172.16.0.5, 192.168.1.1", "10.0.0.2"}, "", "172.16.0.5"},
+		{"spoofed entries left of the client are ignored", "10.0.0.1:1234", []string{"1.2.3.4, 172.16.0.5, 10.0.0.2"}, "", "172.16.0.5"},
+		{"entries with port", "10.0.0.1:1234", []string{"172.16.0.5:5052"}, "", "172.16.0.5"},
+		{"X-Real-IP without X-Forwarded-For", "10.0.0.1:1234", nil, "172.16.0.5", "172.16.0.5"},
+		{"X-Forwarded-For takes precedence over X-Real-IP", "10.0.0.1:1234", []string{"172.16.0.5"}, "172.16.0.6", "172.16.0.5"},
+		{"invalid entry ends at the last trusted proxy", "10.0.0.1:1234", []string{"1.2.3.4, unknown, 10.0.0.2"}, "", "10.0.0.2"},
+		{"invalid entry from the first trusted proxy", "10.0.0.1:1234", []string{"172.16.0.5, garbage"}, "172.16.0.6", "10.0.0.1"},
+		{"only trusted proxies", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"trusted proxy without headers", "10.0.0.1:1234", nil, "", "10.0.0.1"},
+		{"IPv6 direct connection", "[::1]:5052", nil, "", "::1"},
+		{"IPv6 with zone", "[fe80::1%eth0]:5052", nil, "", "fe80::1%eth0"},
+		{"IPv4-mapped IPv6", "[::ffff:172.16.0.5]:1234", nil, "", "172.16.0.5"},
+		{"address without port", "::1", nil, "", "::1"},
+		{"trusted IPv6 proxy", "[fd00::1]:1234", []string{"2001:db8::5"}, "", "2001:db8::5"},
+		{"IPv6 entries with port", "[fd00::1]:1234", []string{"[2001:db8::5]:5052, fd00::2"}, "", "2001:db8::5"},
+		{"IPv6 X-Real-IP", "[fd00::1]:1234", nil, "[2001:db8::5]", "2001:db8::5"},
+		{"IPv4 client through IPv6 proxy", "[fd00::1]:1234", []string{"172.16.0.5"}, "", "172.16.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", nil)
+			require.NoError(t, err)
+			req.RemoteAddr = tt.remoteAddr
+			for _, xff := range tt.xff {
+				req.Header.Add("X-Forwarded-For", xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			require.Equal(t, tt.expected, RemoteHost(req, trusted))
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package beacon identifies the beacon nodes sending requests to the proxy and tracks the one the builders
+// are synced to
+package beacon
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/sirupsen/logrus"
+)
+
+// Entry consists of the address of a beacon node and latest timestamp recorded
+type Entry struct {
+	Addr      string
+	Timestamp uint64
+}
+
+// Tracker keeps the beacon node with the highest timestamp in its requests, which is the one the builders sync to
+type Tracker struct {
+	log  *logrus.Entry
+	mu   sync.Mutex
+	best *Entry
+}
+
+// NewTracker creates a tracker without beacon node, the first request sets it
+func NewTracker(log *logrus.Entry) *Tracker {
+	return &Tracker{log: log}
+}
+
+// Best returns the beacon node the builders are synced to, nil if no request was received yet
+func (t *Tracker) Best() *Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.best == nil {
+		return nil
+	}
+	best := *t.best
+	return &best
+}
+
+// IsBest returns true if the address is the beacon node the builders are synced to
+func (t *Tracker) IsBest(addr string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.best != nil && t.best.Addr == addr
+}
+
+// Update updates for which the proxy / beacon should sync to
+func (t *Tracker) Update(request engineapi.JSONRPCRequest, requestAddr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.best == nil {
+		t.log.WithFields(logrus.Fields{
+			"newAddr": requestAddr,
+		}).Info("request received from beacon node")
+		t.best = &Entry{Addr: requestAddr, Timestamp: 0}
+	}
+
+	// update to compare differences in timestamp
+	var timestamp uint64
+	if strings.HasPrefix(request.Method, engineapi.ForkchoiceUpdated) {
+		switch v := request.Params[1].(type) {
+		case *engineapi.PayloadAttributes:
+			timestamp = v.Timestamp
+		}
+	} else if strings.HasPrefix(request.Method, engineapi.NewPayload) {
+		switch v := request.Params[0].(type) {
+		case *engineapi.ExecutionPayload:
+			timestamp = v.Timestamp
+		}
+	}
+
+	if t.best.Timestamp < timestamp {
+		t.log.WithFields(logrus.Fields{
+			"oldTimestamp": t.best.Timestamp,
+			"oldAddr":      t.best.Addr,
+			"newTimestamp": timestamp,
+			"newAddr":      requestAddr,
+		}).Info(fmt.Sprintf("new timestamp from %s request received from beacon node", request.Method))
+		t.best = &Entry{Timestamp: timestamp, Addr: requestAddr}
+	}
+}
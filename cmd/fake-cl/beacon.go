@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/golang-jwt/jwt"
+)
+
+// Ways a beacon node identifies itself to the proxy
+const (
+	identityXFF    = "xff"    // X-Forwarded-For header, the proxy must trust the fake CL's address
+	identitySource = "source" // source address 127.0.0.x, only for proxies on the loopback interface
+)
+
+// beaconNode sends the Engine API requests of one fake beacon node
+type beaconNode struct {
+	index     int
+	url       string
+	client    *http.Client
+	addr      string // identity of the beacon node
+	identity  string
+	jwtSecret []byte
+
+	// chain of the beacon node after it diverged from the others, nil before
+	chain *chain
+
+	mu     sync.Mutex
+	nextID int
+	stats  map[string]*methodStats
+}
+
+// methodStats are the results of the requests of a method
+type methodStats struct {
+	requests     int
+	errors       int
+	statuses     map[string]int
+	totalLatency time.Duration
+}
+
+func newBeaconNode(index int, url, identity string, jwtSecret []byte, timeout time.Duration) *beaconNode {
+	addr := fmt.Sprintf("127.0.0.%d", index+2)
+	if identity == identityXFF {
+		addr = fmt.Sprintf("10.1.%d.%d", index/250, index%250+1)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if identity == identitySource {
+		dialer := &net.Dialer{Timeout: timeout, LocalAddr: &net.TCPAddr{IP: net.ParseIP(addr)}}
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &beaconNode{
+		index:     index,
+		url:       url,
+		client:    &http.Client{Transport: transport, Timeout: timeout},
+		addr:      addr,
+		identity:  identity,
+		jwtSecret: jwtSecret,
+		stats:     make(map[string]*methodStats),
+	}
+}
+
+// sendSlot sends the newPayload of the slot's block followed by the forkchoiceUpdated to it
+func (b *beaconNode) sendSlot(ctx context.Context, c *chain, head *block, version int, attributesTimestamp uint64) {
+	method, body := newPayloadRequest(head, version, b.id())
+	b.send(ctx, method, body)
+	method, body = forkchoiceRequest(head, c.ancestor(head, 2).hash, version, attributesTimestamp, b.id())
+	b.send(ctx, method, body)
+}
+
+func (b *beaconNode) id() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	return b.nextID
+}
+
+func (b *beaconNode) send(ctx context.Context, method, body string) {
+	start := time.Now()
+	status, err := b.post(ctx, method, body)
+	latency := time.Since(start)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats, ok := b.stats[method]
+	if !ok {
+		stats = &methodStats{statuses: make(map[string]int)}
+		b.stats[method] = stats
+	}
+	stats.requests++
+	stats.totalLatency += latency
+	if err != nil {
+		stats.errors++
+		log.Printf("beacon %d: %s failed: %v", b.index, method, err)
+		return
+	}
+	stats.statuses[status]++
+}
+
+// post sends the request and returns the payload status of the response
+func (b *beaconNode) post(ctx context.Context, method, body string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.identity == identityXFF {
+		req.Header.Set("X-Forwarded-For", b.addr)
+	}
+	if b.jwtSecret != nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iat": time.Now().Unix()})
+		signed, err := token.SignedString(b.jwtSecret)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+signed)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	response, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	if len(response) == 0 {
+		// requests of beacon nodes the proxy isn't synced to are answered without body
+		return "filtered", nil
+	}
+
+	status, err := engineapi.ExtractStatus(method, bytes.NewReader(response))
+	if err != nil {
+		return "", err
+	}
+	if status == "" {
+		return "error", nil
+	}
+	return status, nil
+}
+
+// summary returns the results of the requests by method
+func (b *beaconNode) summary() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	methods := make([]string, 0, len(b.stats))
+	for method := range b.stats {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	var lines []string
+	for _, method := range methods {
+		stats := b.stats[method]
+		statuses := make([]string, 0, len(stats.statuses))
+		for status, count := range stats.statuses {
+			statuses = append(statuses, fmt.Sprintf("%s=%d", status, count))
+		}
+		sort.Strings(statuses)
+		lines = append(lines, fmt.Sprintf("beacon %d (%s) %s: requests=%d errors=%d avg-latency=%s %s", b.index, b.addr, method,
+			stats.requests, stats.errors, (stats.totalLatency/time.Duration(stats.requests)).Round(time.Microsecond), strings.Join(statuses, " ")))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Forks select the versions of the Engine API methods and the shape of the payloads
+var forks = map[string]int{
+	"paris":    1,
+	"shanghai": 2,
+	"cancun":   3,
+	"prague":   4,
+}
+
+// block is a block of the fake chain
+type block struct {
+	hash       string
+	parentHash string
+	number     uint64
+	timestamp  uint64
+}
+
+// chain generates blocks, one per slot
+type chain struct {
+	genesisTime uint64
+	slotSeconds uint64
+	blocks      map[string]*block
+	head        *block
+}
+
+func newChain(genesisTime, slotSeconds uint64) *chain {
+	genesis := &block{hash: randomHex(32), parentHash: zeroHex(32), timestamp: genesisTime}
+	return &chain{
+		genesisTime: genesisTime,
+		slotSeconds: slotSeconds,
+		blocks:      map[string]*block{genesis.hash: genesis},
+		head:        genesis,
+	}
+}
+
+// next builds the block of the slot on top of the head
+func (c *chain) next(slot uint64) *block {
+	return c.extend(c.head, slot)
+}
+
+// reorg builds the block of the slot on top of the head's parent, replacing the head
+func (c *chain) reorg(slot uint64) *block {
+	parent, ok := c.blocks[c.head.parentHash]
+	if !ok {
+		return c.next(slot)
+	}
+	return c.extend(parent, slot)
+}
+
+func (c *chain) extend(parent *block, slot uint64) *block {
+	b := &block{
+		hash:       randomHex(32),
+		parentHash: parent.hash,
+		number:     parent.number + 1,
+		timestamp:  c.genesisTime + slot*c.slotSeconds,
+	}
+	c.blocks[b.hash] = b
+	c.head = b
+	return b
+}
+
+// ancestor returns the ancestor of the block depth blocks back, or the oldest known one
+func (c *chain) ancestor(b *block, depth int) *block {
+	for i := 0; i < depth; i++ {
+		parent, ok := c.blocks[b.parentHash]
+		if !ok {
+			break
+		}
+		b = parent
+	}
+	return b
+}
+
+// fork returns a copy of the chain which continues independently, for a diverging beacon node
+func (c *chain) fork() *chain {
+	blocks := make(map[string]*block, len(c.blocks))
+	for hash, b := range c.blocks {
+		blocks[hash] = b
+	}
+	return &chain{genesisTime: c.genesisTime, slotSeconds: c.slotSeconds, blocks: blocks, head: c.head}
+}
+
+// newPayloadRequest returns the method and body of the newPayload request of the block with the payload shape
+// of the version
+func newPayloadRequest(b *block, version int, id int) (string, string) {
+	fields := []string{
+		fmt.Sprintf(`"parentHash":"%s"`, b.parentHash),
+		fmt.Sprintf(`"feeRecipient":"%s"`, zeroHex(20)),
+		fmt.Sprintf(`"stateRoot":"%s"`, randomHex(32)),
+		fmt.Sprintf(`"receiptsRoot":"%s"`, randomHex(32)),
+		fmt.Sprintf(`"logsBloom":"%s"`, zeroHex(256)),
+		fmt.Sprintf(`"prevRandao":"%s"`, randomHex(32)),
+		fmt.Sprintf(`"blockNumber":"0x%x"`, b.number),
+		`"gasLimit":"0x1c9c380"`,
+		`"gasUsed":"0x0"`,
+		fmt.Sprintf(`"timestamp":"0x%x"`, b.timestamp),
+		`"extraData":"0x"`,
+		`"baseFeePerGas":"0x7"`,
+		fmt.Sprintf(`"blockHash":"%s"`, b.hash),
+		`"transactions":[]`,
+	}
+	if version >= 2 {
+		fields = append(fields, `"withdrawals":[]`)
+	}
+	if version >= 3 {
+		fields = append(fields, `"blobGasUsed":"0x0"`, `"excessBlobGas":"0x0"`)
+	}
+
+	params := []string{"{" + strings.Join(fields, ",") + "}"}
+	if version >= 3 {
+		// versioned hashes and parent beacon block root
+		params = append(params, "[]", fmt.Sprintf(`"%s"`, randomHex(32)))
+	}
+	if version >= 4 {
+		// execution requests
+		params = append(params, "[]")
+	}
+	method := fmt.Sprintf("engine_newPayloadV%d", version)
+	return method, fmt.Sprintf(`{"jsonrpc":"2.0","method":"%s","params":[%s],"id":%d}`, method, strings.Join(params, ","), id)
+}
+
+// forkchoiceRequest returns the method and body of the forkchoiceUpdated request for the head, with the
+// attributes of a block in the next slot if timestamp is set
+func forkchoiceRequest(head *block, finalized string, version int, timestamp uint64, id int) (string, string) {
+	// forkchoiceUpdatedV3 is used for cancun and prague
+	fcuVersion := min(version, 3)
+	attributes := "null"
+	if timestamp != 0 {
+		fields := []string{
+			fmt.Sprintf(`"timestamp":"0x%x"`, timestamp),
+			fmt.Sprintf(`"prevRandao":"%s"`, randomHex(32)),
+			fmt.Sprintf(`"suggestedFeeRecipient":"%s"`, zeroHex(20)),
+		}
+		if fcuVersion >= 2 {
+			fields = append(fields, `"withdrawals":[]`)
+		}
+		if fcuVersion >= 3 {
+			fields = append(fields, fmt.Sprintf(`"parentBeaconBlockRoot":"%s"`, randomHex(32)))
+		}
+		attributes = "{" + strings.Join(fields, ",") + "}"
+	}
+	state := fmt.Sprintf(`{"headBlockHash":"%s","safeBlockHash":"%s","finalizedBlockHash":"%s"}`, head.hash, finalized, finalized)
+	method := fmt.Sprintf("engine_forkchoiceUpdatedV%d", fcuVersion)
+	return method, fmt.Sprintf(`{"jsonrpc":"2.0","method":"%s","params":[%s,%s],"id":%d}`, method, state, attributes, id)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b) //nolint:errcheck
+	return "0x" + hex.EncodeToString(b)
+}
+
+func zeroHex(n int) string {
+	return "0x" + strings.Repeat("00", n)
+}
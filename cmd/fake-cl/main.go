@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/flashbots/sync-proxy/proxy"
+)
+
+var (
+	proxyURL        = flag.String("url", "http://localhost:25590", "url of the sync proxy or execution client to send the requests to")
+	numBeacons      = flag.Int("beacons", 2, "number of concurrent beacon nodes")
+	identity        = flag.String("identity", identityXFF, "how beacon nodes are told apart: xff (X-Forwarded-For, start the proxy with -trusted-proxies=127.0.0.1) or source (source address 127.0.0.x)")
+	jwtSecretFile   = flag.String("jwt-secret", "", "path to the hex encoded JWT secret to sign the requests with")
+	fork            = flag.String("fork", "cancun", "fork of the payload shapes and method versions: paris, shanghai, cancun or prague")
+	slotTimeMs      = flag.Int("slot-time", 12000, "duration of a slot [ms]")
+	numSlots        = flag.Uint64("slots", 0, "number of slots to run, 0 to run until interrupted")
+	reorgEvery      = flag.Uint64("reorg-every", 0, "reorg the head every this many slots, 0 for no reorgs")
+	attributesEvery = flag.Uint64("attributes-every", 4, "send payload attributes every this many slots, 0 for never")
+	lagMs           = flag.Int("lag", 50, "delay of each beacon node after the one before it in a slot [ms]")
+	outages         = flag.String("down", "", "comma-separated beacon:slot:slots, the beacon node doesn't send requests for slots from slot on")
+	diverge         = flag.String("diverge", "", "comma-separated beacon:slot, the beacon node follows its own chain from slot on")
+	timeoutMs       = flag.Int("timeout", 8000, "timeout of a request [ms]")
+)
+
+func main() {
+	flag.Parse()
+
+	version, ok := forks[*fork]
+	if !ok {
+		log.Fatalf("unknown fork %s", *fork)
+	}
+	if *identity != identityXFF && *identity != identitySource {
+		log.Fatalf("unknown identity %s, expected xff or source", *identity)
+	}
+	parsedOutages, err := parseOutages(*outages)
+	if err != nil {
+		log.Fatal(err)
+	}
+	parsedDiverge, err := parseDiverge(*diverge)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var jwtSecret []byte
+	if *jwtSecretFile != "" {
+		jwtSecret, err = proxy.LoadJWTSecret(*jwtSecretFile)
+		if err != nil {
+			log.Fatalf("failed to load JWT secret: %v", err)
+		}
+	}
+
+	s := &scenario{
+		slotTime:        time.Duration(*slotTimeMs) * time.Millisecond,
+		slots:           *numSlots,
+		version:         version,
+		reorgEvery:      *reorgEvery,
+		attributesEvery: *attributesEvery,
+		lag:             time.Duration(*lagMs) * time.Millisecond,
+		outages:         parsedOutages,
+		diverge:         parsedDiverge,
+	}
+	for i := 0; i < *numBeacons; i++ {
+		s.beacons = append(s.beacons, newBeaconNode(i, *proxyURL, *identity, jwtSecret, time.Duration(*timeoutMs)*time.Millisecond))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Sending %s requests of %d beacon nodes to %s every %s", *fork, *numBeacons, *proxyURL, s.slotTime)
+	s.run(ctx)
+
+	for _, beacon := range s.beacons {
+		log.Printf("\n%s", beacon.summary())
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outage is a beacon node going down for a number of slots
+type outage struct {
+	beacon int
+	slot   uint64
+	slots  uint64
+}
+
+// scenario drives the fake beacon nodes slot by slot
+type scenario struct {
+	beacons         []*beaconNode
+	slotTime        time.Duration
+	slots           uint64 // number of slots to run, 0 to run until cancelled
+	version         int
+	reorgEvery      uint64 // reorg the head every this many slots, never if 0
+	attributesEvery uint64 // send payload attributes every this many slots, never if 0
+	lag             time.Duration
+	outages         []outage
+	diverge         map[int]uint64 // slot from which a beacon node follows its own chain
+}
+
+// run sends the requests of each slot from all beacon nodes: the network's new block, or a block of the
+// beacon node's own chain after it diverged, followed by a forkchoiceUpdated to it
+func (s *scenario) run(ctx context.Context) {
+	network := newChain(uint64(time.Now().Unix()), max(uint64(s.slotTime.Seconds()), 1))
+	ticker := time.NewTicker(s.slotTime)
+	defer ticker.Stop()
+
+	for slot := uint64(1); s.slots == 0 || slot <= s.slots; slot++ {
+		head := network.next(slot)
+		if s.reorgEvery > 0 && slot > 1 && slot%s.reorgEvery == 0 {
+			head = network.reorg(slot)
+			log.Printf("slot %d: reorg to block %d %s", slot, head.number, head.hash)
+		}
+		var attributesTimestamp uint64
+		if s.attributesEvery > 0 && slot%s.attributesEvery == 0 {
+			attributesTimestamp = head.timestamp + network.slotSeconds
+		}
+
+		var wg sync.WaitGroup
+		for _, beacon := range s.beacons {
+			if s.isDown(beacon.index, slot) {
+				continue
+			}
+			c, beaconHead := network, head
+			if divergeSlot, ok := s.diverge[beacon.index]; ok && slot >= divergeSlot {
+				if beacon.chain == nil {
+					log.Printf("slot %d: beacon %d diverges from the network", slot, beacon.index)
+					beacon.chain = network.fork()
+					beacon.chain.head = network.ancestor(head, 1)
+				}
+				c, beaconHead = beacon.chain, beacon.chain.next(slot)
+			}
+
+			wg.Add(1)
+			go func(beacon *beaconNode) {
+				defer wg.Done()
+				select {
+				case <-time.After(time.Duration(beacon.index) * s.lag):
+				case <-ctx.Done():
+					return
+				}
+				beacon.sendSlot(ctx, c, beaconHead, s.version, attributesTimestamp)
+			}(beacon)
+		}
+		wg.Wait()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *scenario) isDown(beacon int, slot uint64) bool {
+	for _, o := range s.outages {
+		if o.beacon == beacon && slot >= o.slot && slot < o.slot+o.slots {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOutages parses a comma-separated list of beacon:slot:slots
+func parseOutages(s string) ([]outage, error) {
+	var outages []outage
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		values, err := parseUints(entry, 3)
+		if err != nil {
+			return nil, fmt.Errorf("invalid outage %s, expected beacon:slot:slots: %w", entry, err)
+		}
+		outages = append(outages, outage{beacon: int(values[0]), slot: values[1], slots: values[2]})
+	}
+	return outages, nil
+}
+
+// parseDiverge parses a comma-separated list of beacon:slot
+func parseDiverge(s string) (map[int]uint64, error) {
+	diverge := make(map[int]uint64)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		values, err := parseUints(entry, 2)
+		if err != nil {
+			return nil, fmt.Errorf("invalid divergence %s, expected beacon:slot: %w", entry, err)
+		}
+		diverge[int(values[0])] = values[1]
+	}
+	return diverge, nil
+}
+
+func parseUints(s string, n int) ([]uint64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d values", n)
+	}
+	values := make([]uint64, n)
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
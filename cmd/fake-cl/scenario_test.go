@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/beacon"
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/flashbots/sync-proxy/proxy"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestShapes(t *testing.T) {
+	c := newChain(1000, 12)
+	head := c.next(1)
+
+	for _, version := range forks {
+		method, body := newPayloadRequest(head, version, 1)
+		var request engineapi.JSONRPCRequest
+		require.NoError(t, json.Unmarshal([]byte(body), &request), body)
+		require.Equal(t, method, request.Method)
+		require.Equal(t, uint64(1012), request.Params[0].(*engineapi.ExecutionPayload).Timestamp)
+
+		method, body = forkchoiceRequest(head, c.ancestor(head, 2).hash, version, head.timestamp+12, 2)
+		require.NoError(t, json.Unmarshal([]byte(body), &request), body)
+		require.Equal(t, method, request.Method)
+		require.Equal(t, uint64(1024), request.Params[1].(*engineapi.PayloadAttributes).Timestamp)
+	}
+}
+
+func TestChainReorg(t *testing.T) {
+	c := newChain(1000, 12)
+	first := c.next(1)
+	second := c.next(2)
+	reorged := c.reorg(3)
+	require.Equal(t, first.hash, reorged.parentHash)
+	require.Equal(t, second.number, reorged.number)
+	require.Equal(t, first.hash, c.ancestor(c.next(4), 2).hash)
+}
+
+func TestScenario(t *testing.T) {
+	builder := mocks.NewServer(t)
+	builder.Response = []byte(mocks.NewPayloadResponseValid)
+	builderURL, err := url.Parse(builder.Server.URL)
+	require.NoError(t, err)
+	trusted, err := beacon.ParseIPList("127.0.0.1")
+	require.NoError(t, err)
+
+	service, err := proxy.NewProxyService(proxy.ProxyServiceOpts{
+		Log:            logrus.WithField("testing", true),
+		Builders:       []*url.URL{builderURL},
+		BuilderTimeout: time.Second,
+		TrustedProxies: trusted,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	s := &scenario{
+		slotTime:        20 * time.Millisecond,
+		slots:           4,
+		version:         3,
+		attributesEvery: 1,
+		lag:             5 * time.Millisecond,
+		outages:         []outage{{beacon: 1, slot: 2, slots: 2}},
+	}
+	for i := 0; i < 2; i++ {
+		s.beacons = append(s.beacons, newBeaconNode(i, server.URL, identityXFF, nil, time.Second))
+	}
+	s.run(context.Background())
+
+	// newPayloads of all beacon nodes are sent to the builders, forkchoiceUpdated only of the one the proxy follows
+	require.Equal(t, 6, builder.GetRequestCount("engine_newPayloadV3"))
+	require.Equal(t, 4, builder.GetRequestCount("engine_forkchoiceUpdatedV3"))
+	require.Equal(t, 4, s.beacons[0].stats["engine_forkchoiceUpdatedV3"].requests)
+	require.Equal(t, 2, s.beacons[1].stats["engine_forkchoiceUpdatedV3"].statuses["filtered"])
+	require.Zero(t, s.beacons[0].stats["engine_newPayloadV3"].errors)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/golang-jwt/jwt"
+)
+
+// jwtMaxAge is the max difference between the iat claim and the current time, as checked by execution clients
+const jwtMaxAge = 60 * time.Second
+
+var (
+	errMissingJWT = errors.New("missing token")
+	errInvalidIAT = errors.New("stale or future iat claim")
+)
+
+// block is a payload the mock EL received
+type block struct {
+	parentHash string
+	number     uint64
+	status     string
+}
+
+// payload contains the fields of an execution payload the mock EL reads, the same in all versions
+type payload struct {
+	BlockHash   string `json:"blockHash"`
+	ParentHash  string `json:"parentHash"`
+	BlockNumber string `json:"blockNumber"`
+}
+
+type forkchoiceState struct {
+	HeadBlockHash      string `json:"headBlockHash"`
+	SafeBlockHash      string `json:"safeBlockHash"`
+	FinalizedBlockHash string `json:"finalizedBlockHash"`
+}
+
+type request struct {
+	JSONRPC string            `json:"jsonrpc"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+	ID      json.RawMessage   `json:"id"`
+}
+
+type payloadStatus struct {
+	Status          string  `json:"status"`
+	LatestValidHash *string `json:"latestValidHash"`
+	ValidationError *string `json:"validationError"`
+}
+
+type forkchoiceResponse struct {
+	PayloadStatus payloadStatus `json:"payloadStatus"`
+	PayloadID     *string       `json:"payloadId"`
+}
+
+// mockEL is a fake execution client which keeps the chain of payloads it received. Payloads extending a known
+// VALID block are VALID, others get the unknown parent status, and the rules can change every response.
+type mockEL struct {
+	jwtSecret           []byte
+	gzip                bool
+	latency             time.Duration
+	unknownParentStatus string
+	rules               *ruleSet
+
+	mu     sync.Mutex
+	blocks map[string]*block
+	head   string
+}
+
+func newMockEL(config *Config, jwtSecret []byte, gzip bool, latency time.Duration) *mockEL {
+	unknownParentStatus := config.UnknownParentStatus
+	if unknownParentStatus == "" {
+		unknownParentStatus = statusSyncing
+	}
+	return &mockEL{
+		jwtSecret:           jwtSecret,
+		gzip:                gzip,
+		latency:             latency,
+		unknownParentStatus: unknownParentStatus,
+		rules:               newRuleSet(config.Rules),
+		blocks:              make(map[string]*block),
+	}
+}
+
+func (m *mockEL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.status()) //nolint:errcheck
+		return
+	}
+
+	if m.jwtSecret != nil {
+		if err := m.checkJWT(r.Header.Get("Authorization")); err != nil {
+			log.Printf("rejected request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		body, err = compression.Decode(r.Header.Get("Content-Encoding"), body)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		m.write(w, r, nil, engineapi.NewJSONRPCError(nil, engineapi.CodeParseError, err.Error()))
+		return
+	}
+
+	rule := m.rules.match(req.Method)
+	latency := m.latency
+	if rule != nil && rule.Latency > 0 {
+		latency = rule.Latency.Duration()
+	}
+	time.Sleep(latency)
+
+	switch {
+	case rule != nil && rule.Disconnect:
+		log.Printf("%s: disconnecting", req.Method)
+		disconnect(w)
+		return
+	case rule != nil && rule.HTTPStatus != 0:
+		log.Printf("%s: responding with HTTP status %d", req.Method, rule.HTTPStatus)
+		w.WriteHeader(rule.HTTPStatus)
+		return
+	case rule != nil && rule.Error != nil:
+		log.Printf("%s: responding with error %d", req.Method, rule.Error.Code)
+		m.write(w, r, rule, engineapi.NewJSONRPCError(req.ID, rule.Error.Code, rule.Error.Message))
+		return
+	}
+
+	status := ""
+	if rule != nil {
+		status = rule.Status
+	}
+	result, err := m.handle(req, status)
+	if err != nil {
+		m.write(w, r, rule, engineapi.NewJSONRPCError(req.ID, engineapi.CodeServerError, err.Error()))
+		return
+	}
+	response, err := json.Marshal(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  any             `json:"result"`
+	}{"2.0", req.ID, result})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.write(w, r, rule, response)
+}
+
+// handle returns the result of the request, status overrides the payload status of the chain if set
+func (m *mockEL) handle(req request, status string) (any, error) {
+	switch {
+	case strings.HasPrefix(req.Method, engineapi.NewPayload):
+		if len(req.Params) < 1 {
+			return nil, fmt.Errorf("expected at least 1 param for newPayload")
+		}
+		var p payload
+		if err := json.Unmarshal(req.Params[0], &p); err != nil {
+			return nil, err
+		}
+		return m.newPayload(p, status), nil
+	case strings.HasPrefix(req.Method, engineapi.ForkchoiceUpdated):
+		if len(req.Params) < 2 {
+			return nil, fmt.Errorf("expected at least 2 params for forkchoiceUpdated")
+		}
+		var state forkchoiceState
+		if err := json.Unmarshal(req.Params[0], &state); err != nil {
+			return nil, err
+		}
+		return m.forkchoiceUpdated(state, string(req.Params[1]) != "null", status), nil
+	case req.Method == "engine_exchangeCapabilities":
+		return []string{
+			"engine_newPayloadV1", "engine_newPayloadV2", "engine_newPayloadV3", "engine_newPayloadV4",
+			"engine_forkchoiceUpdatedV1", "engine_forkchoiceUpdatedV2", "engine_forkchoiceUpdatedV3",
+		}, nil
+	case req.Method == "engine_exchangeTransitionConfigurationV1" && len(req.Params) > 0:
+		return req.Params[0], nil
+	case req.Method == "eth_chainId":
+		return "0x1", nil
+	case req.Method == "eth_syncing":
+		return false, nil
+	default:
+		return nil, fmt.Errorf("the method %s does not exist/is not available", req.Method)
+	}
+}
+
+func (m *mockEL) newPayload(p payload, status string) payloadStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	number, _ := parseQuantity(p.BlockNumber)
+	parent, knownParent := m.blocks[p.ParentHash]
+	if status == "" {
+		switch {
+		case knownParent && parent.status == statusInvalid:
+			status = statusInvalid
+		case (knownParent && parent.status == statusValid) || len(m.blocks) == 0:
+			// the first payload is the anchor of the chain
+			status = statusValid
+		default:
+			status = m.unknownParentStatus
+		}
+	}
+
+	if existing, ok := m.blocks[p.BlockHash]; !ok || existing.status != statusValid {
+		m.blocks[p.BlockHash] = &block{parentHash: p.ParentHash, number: number, status: status}
+	}
+	log.Printf("newPayload %d %s: %s", number, p.BlockHash, status)
+
+	response := payloadStatus{Status: status}
+	switch status {
+	case statusValid:
+		response.LatestValidHash = &p.BlockHash
+	case statusInvalid:
+		validationError := "invalid payload"
+		response.ValidationError = &validationError
+		if knownParent && parent.status == statusValid {
+			response.LatestValidHash = &p.ParentHash
+		}
+	}
+	return response
+}
+
+func (m *mockEL) forkchoiceUpdated(state forkchoiceState, hasAttributes bool, status string) forkchoiceResponse {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	head, knownHead := m.blocks[state.HeadBlockHash]
+	if status == "" {
+		switch {
+		case !knownHead:
+			status = statusSyncing
+		case head.status == statusInvalid:
+			status = statusInvalid
+		case head.status == statusValid:
+			status = statusValid
+		default:
+			status = statusSyncing
+		}
+	}
+	if status == statusValid {
+		m.head = state.HeadBlockHash
+	}
+	log.Printf("forkchoiceUpdated %s: %s", state.HeadBlockHash, status)
+
+	response := forkchoiceResponse{PayloadStatus: payloadStatus{Status: status}}
+	if status == statusValid {
+		response.PayloadStatus.LatestValidHash = &state.HeadBlockHash
+		if hasAttributes {
+			id := make([]byte, 8)
+			rand.Read(id) //nolint:errcheck
+			payloadID := "0x" + hex.EncodeToString(id)
+			response.PayloadID = &payloadID
+		}
+	}
+	return response
+}
+
+// chainStatus is served on GET requests
+type chainStatus struct {
+	Head       string `json:"head"`
+	HeadNumber uint64 `json:"headNumber"`
+	NumBlocks  int    `json:"numBlocks"`
+}
+
+func (m *mockEL) status() chainStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := chainStatus{Head: m.head, NumBlocks: len(m.blocks)}
+	if head, ok := m.blocks[m.head]; ok {
+		status.HeadNumber = head.number
+	}
+	return status
+}
+
+// checkJWT checks the bearer token like an execution client: signed with the secret and issued within a minute
+func (m *mockEL) checkJWT(auth string) error {
+	tokenString, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return errMissingJWT
+	}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return m.jwtSecret, nil
+	})
+	if err != nil {
+		return err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return errInvalidIAT
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok || math.Abs(float64(time.Now().Unix())-iat) > jwtMaxAge.Seconds() {
+		return errInvalidIAT
+	}
+	return nil
+}
+
+// write sends the response, compressed with gzip if the mock EL compresses responses and the client accepts
+// it or the rule forces it, and truncated if the rule says so
+func (m *mockEL) write(w http.ResponseWriter, r *http.Request, rule *Rule, response []byte) {
+	if (m.gzip && compression.Accepts(r.Header, compression.Gzip)) || (rule != nil && rule.Gzip) {
+		encoded, err := compression.Encode(compression.Gzip, response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response = encoded
+		w.Header().Set("Content-Encoding", compression.Gzip)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if rule != nil && rule.Truncate {
+		// the Content-Length of the full response makes the client fail reading the body
+		w.Header().Set("Content-Length", fmt.Sprint(len(response)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(response[:len(response)/2])   //nolint:errcheck
+		http.NewResponseController(w).Flush() //nolint:errcheck
+		disconnect(w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(response) //nolint:errcheck
+}
+
+// disconnect closes the connection of the request, what was written of the response is sent before
+func disconnect(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	conn.Close()
+}
+
+// parseQuantity parses a hex encoded quantity like 0x1b4
+func parseQuantity(s string) (uint64, error) {
+	var number uint64
+	_, err := fmt.Sscanf(s, "0x%x", &number)
+	return number, err
+}
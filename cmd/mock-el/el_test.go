@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/proxy"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func newPayloadRequest(number int, hash, parentHash string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"engine_newPayloadV3","params":[{"blockNumber":"0x%x","blockHash":"%s","parentHash":"%s"},[],"0x00"],"id":%d}`, number, hash, parentHash, number)
+}
+
+func forkchoiceRequest(head string, attributes bool) string {
+	payloadAttributes := "null"
+	if attributes {
+		payloadAttributes = `{"timestamp":"0x1"}`
+	}
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"engine_forkchoiceUpdatedV3","params":[{"headBlockHash":"%s","safeBlockHash":"%s","finalizedBlockHash":"%s"},%s],"id":1}`, head, head, head, payloadAttributes)
+}
+
+func sendRequest(t *testing.T, el *mockEL, body string, header http.Header) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	el.ServeHTTP(rr, req)
+	return rr
+}
+
+func requireNewPayloadStatus(t *testing.T, rr *httptest.ResponseRecorder, expected string) {
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	status, err := engineapi.ExtractStatus("engine_newPayloadV3", rr.Body)
+	require.NoError(t, err)
+	require.Equal(t, expected, status)
+}
+
+func TestChain(t *testing.T) {
+	el := newMockEL(&Config{}, nil, false, 0)
+
+	requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(1, "0x01", "0x00"), nil), statusValid)
+	requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(2, "0x02", "0x01"), nil), statusValid)
+	requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(4, "0x04", "0x03"), nil), statusSyncing)
+	// children of unknown blocks aren't valid either
+	requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(5, "0x05", "0x04"), nil), statusSyncing)
+
+	rr := sendRequest(t, el, forkchoiceRequest("0x02", true), nil)
+	var response struct {
+		Result forkchoiceResponse `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Equal(t, statusValid, response.Result.PayloadStatus.Status)
+	require.NotNil(t, response.Result.PayloadID)
+	require.Equal(t, chainStatus{Head: "0x02", HeadNumber: 2, NumBlocks: 4}, el.status())
+
+	rr = sendRequest(t, el, forkchoiceRequest("0x05", false), nil)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Equal(t, statusSyncing, response.Result.PayloadStatus.Status)
+	require.Nil(t, response.Result.PayloadID)
+	require.Equal(t, "0x02", el.status().Head)
+
+	el = newMockEL(&Config{UnknownParentStatus: statusAccepted}, nil, false, 0)
+	requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(1, "0x01", "0x00"), nil), statusValid)
+	requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(3, "0x03", "0x02"), nil), statusAccepted)
+}
+
+func TestRules(t *testing.T) {
+	t.Run("should apply scripted rules in order", func(t *testing.T) {
+		el := newMockEL(&Config{Rules: []*Rule{
+			{Method: "engine_newPayload", Status: statusSyncing, Count: 2},
+			{Method: "engine_newPayload", Status: statusInvalid, Count: 1},
+		}}, nil, false, 0)
+
+		requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(1, "0x01", "0x00"), nil), statusSyncing)
+		requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(1, "0x01", "0x00"), nil), statusSyncing)
+		requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(2, "0x02", "0x01"), nil), statusInvalid)
+		// the child of an invalid block is invalid
+		requireNewPayloadStatus(t, sendRequest(t, el, newPayloadRequest(3, "0x03", "0x02"), nil), statusInvalid)
+	})
+
+	t.Run("should inject errors and latency", func(t *testing.T) {
+		el := newMockEL(&Config{Rules: []*Rule{
+			{Method: "engine_forkchoiceUpdated", HTTPStatus: http.StatusServiceUnavailable, Count: 1},
+			{Method: "engine_forkchoiceUpdated", Error: &engineapi.JSONRPCError{Code: -38003, Message: "Invalid payload attributes"}, Count: 1},
+			{Method: "engine_newPayload", Latency: proxy.Duration(50 * time.Millisecond), Gzip: true},
+		}}, nil, false, 0)
+
+		rr := sendRequest(t, el, forkchoiceRequest("0x01", true), nil)
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+		rr = sendRequest(t, el, forkchoiceRequest("0x01", true), nil)
+		var errorResponse engineapi.JSONRPCErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errorResponse))
+		require.Equal(t, -38003, errorResponse.Error.Code)
+
+		start := time.Now()
+		rr = sendRequest(t, el, newPayloadRequest(1, "0x01", "0x00"), nil)
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		require.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("should disconnect and truncate responses", func(t *testing.T) {
+		el := newMockEL(&Config{Rules: []*Rule{
+			{Disconnect: true, Count: 1},
+			{Truncate: true, Count: 1},
+		}}, nil, false, 0)
+		server := httptest.NewServer(el)
+		defer server.Close()
+
+		_, err := http.Post(server.URL, "application/json", bytes.NewReader([]byte(newPayloadRequest(1, "0x01", "0x00"))))
+		require.Error(t, err)
+
+		resp, err := http.Post(server.URL, "application/json", bytes.NewReader([]byte(newPayloadRequest(1, "0x01", "0x00"))))
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		resp.Body.Close()
+
+		resp, err = http.Post(server.URL, "application/json", bytes.NewReader([]byte(newPayloadRequest(1, "0x01", "0x00"))))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should reject empty rules", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"rules": [null]}`), 0o600))
+		_, err := loadConfig(path)
+		require.EqualError(t, err, "rule 0 is empty")
+	})
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("secret")
+	el := newMockEL(&Config{}, secret, false, 0)
+	sign := func(iat time.Time) http.Header {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iat": iat.Unix()})
+		signed, err := token.SignedString(secret)
+		require.NoError(t, err)
+		return http.Header{"Authorization": []string{"Bearer " + signed}}
+	}
+
+	rr := sendRequest(t, el, newPayloadRequest(1, "0x01", "0x00"), nil)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = sendRequest(t, el, newPayloadRequest(1, "0x01", "0x00"), sign(time.Now().Add(-2*time.Minute)))
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = sendRequest(t, el, newPayloadRequest(1, "0x01", "0x00"), sign(time.Now()))
+	requireNewPayloadStatus(t, rr, statusValid)
+}
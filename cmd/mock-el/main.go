@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/flashbots/sync-proxy/proxy"
+)
+
+var (
+	listenAddr    = flag.String("addr", "localhost:8551", "listen address")
+	rulesFile     = flag.String("rules", "", "path to an optional JSON file with rules and scripted scenarios for the responses")
+	jwtSecretFile = flag.String("jwt-secret", "", "path to the hex encoded JWT secret, requests without a valid JWT are rejected if set")
+	gzipResponses = flag.Bool("gzip", false, "gzip responses to clients accepting gzip")
+	latencyMs     = flag.Int("latency", 0, "delay before each response [ms]")
+)
+
+func main() {
+	flag.Parse()
+
+	config := &Config{}
+	if *rulesFile != "" {
+		var err error
+		config, err = loadConfig(*rulesFile)
+		if err != nil {
+			log.Fatalf("failed to load rules: %v", err)
+		}
+	}
+
+	var jwtSecret []byte
+	if *jwtSecretFile != "" {
+		var err error
+		jwtSecret, err = proxy.LoadJWTSecret(*jwtSecretFile)
+		if err != nil {
+			log.Fatalf("failed to load JWT secret: %v", err)
+		}
+	}
+
+	el := newMockEL(config, jwtSecret, *gzipResponses, time.Duration(*latencyMs)*time.Millisecond)
+
+	log.Printf("Starting mock EL on %s with %d rules", *listenAddr, len(config.Rules))
+	if err := http.ListenAndServe(*listenAddr, el); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
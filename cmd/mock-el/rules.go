@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/proxy"
+)
+
+// Payload statuses of the Engine API
+const (
+	statusValid    = "VALID"
+	statusInvalid  = "INVALID"
+	statusSyncing  = "SYNCING"
+	statusAccepted = "ACCEPTED"
+)
+
+// Config is the rules file of the mock EL
+type Config struct {
+	// payload status of newPayloads whose parent is unknown, SYNCING or ACCEPTED
+	UnknownParentStatus string `json:"unknown_parent_status,omitempty"`
+	// rules are checked in order for each request, the first matching rule is applied
+	Rules []*Rule `json:"rules"`
+}
+
+// Rule changes the response to matching requests. A rule with a count is used up after count requests, so
+// a list of rules with counts is a scripted scenario.
+type Rule struct {
+	Method      string                  `json:"method,omitempty"`      // method prefix, all methods if empty
+	Probability float64                 `json:"probability,omitempty"` // share of matching requests the rule applies to, all if 0
+	Count       int                     `json:"count,omitempty"`       // number of requests the rule applies to, unlimited if 0
+	Status      string                  `json:"status,omitempty"`      // payload status instead of the one of the chain
+	Latency     proxy.Duration          `json:"latency,omitempty"`     // delay before the response
+	Error       *engineapi.JSONRPCError `json:"error,omitempty"`       // JSON-RPC error response
+	HTTPStatus  int                     `json:"http_status,omitempty"` // HTTP error status without body
+	Disconnect  bool                    `json:"disconnect,omitempty"`  // close the connection without response
+	Gzip        bool                    `json:"gzip,omitempty"`        // gzip the response even if it wasn't accepted
+	Truncate    bool                    `json:"truncate,omitempty"`    // send only the first half of the response
+}
+
+func (r *Rule) validate() error {
+	switch r.Status {
+	case "", statusValid, statusInvalid, statusSyncing, statusAccepted:
+	default:
+		return fmt.Errorf("invalid status %s", r.Status)
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("invalid probability %v", r.Probability)
+	}
+	if r.Count < 0 {
+		return fmt.Errorf("invalid count %d", r.Count)
+	}
+	return nil
+}
+
+// loadConfig reads the rules file
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *Config) validate() error {
+	switch c.UnknownParentStatus {
+	case "", statusSyncing, statusAccepted:
+	default:
+		return fmt.Errorf("invalid unknown parent status %s, expected SYNCING or ACCEPTED", c.UnknownParentStatus)
+	}
+	for i, rule := range c.Rules {
+		if rule == nil {
+			return fmt.Errorf("rule %d is empty", i)
+		}
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ruleSet picks the rule applied to a request
+type ruleSet struct {
+	mu    sync.Mutex
+	rules []*Rule
+	used  []int
+}
+
+func newRuleSet(rules []*Rule) *ruleSet {
+	return &ruleSet{rules: rules, used: make([]int, len(rules))}
+}
+
+// match returns the first rule for the method which isn't used up and isn't skipped by its probability,
+// nil if there is none
+func (s *ruleSet) match(method string) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rule := range s.rules {
+		if !strings.HasPrefix(method, rule.Method) || (rule.Count > 0 && s.used[i] >= rule.Count) {
+			continue
+		}
+		if rule.Probability > 0 && rand.Float64() >= rule.Probability { //nolint:gosec
+			continue
+		}
+		s.used[i]++
+		return rule
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Package compression implements the Content-Encodings of requests and responses: gzip and zstd
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrUnsupported is returned for Content-Encodings other than identity, gzip and zstd
+var ErrUnsupported = errors.New("unsupported content encoding")
+
+// Supported Content-Encodings
+const (
+	Identity = "identity"
+	Gzip     = "gzip"
+	Zstd     = "zstd"
+)
+
+// Decode decompresses a request or response body with the given Content-Encoding
+func Decode(encoding string, body []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", Identity:
+		return body, nil
+	case Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case Zstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(body, nil)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, encoding)
+	}
+}
+
+// DecodeReader decompresses a request or response stream with the given Content-Encoding
+func DecodeReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", Identity:
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, encoding)
+	}
+}
+
+// Encode compresses a request body with the given Content-Encoding
+func Encode(encoding string, body []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", Identity:
+		return body, nil
+	case Gzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(body); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(body, nil), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, encoding)
+	}
+}
+
+// IsSupported returns true if the encoding can be decoded and encoded
+func IsSupported(encoding string) bool {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", Identity, Gzip, Zstd:
+		return true
+	default:
+		return false
+	}
+}
+
+// Accepts returns true if the Accept-Encoding header allows a response with the given Content-Encoding
+func Accepts(header http.Header, encoding string) bool {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" || encoding == Identity {
+		return true
+	}
+
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, entry := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(entry, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != encoding && name != "*" {
+				continue
+			}
+			// q=0 means the encoding is not acceptable
+			q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+			return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package compression
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	body := []byte(`{"jsonrpc":"2.0","id":1,"method":"engine_newPayloadV1","params":[]}`)
+	for _, encoding := range []string{"", Identity, Gzip, Zstd} {
+		encoded, err := Encode(encoding, body)
+		require.NoError(t, err)
+		decoded, err := Decode(encoding, encoded)
+		require.NoError(t, err)
+		require.Equal(t, body, decoded)
+	}
+
+	_, err := Decode("br", body)
+	require.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestAccepts(t *testing.T) {
+	header := http.Header{}
+	require.True(t, Accepts(header, ""))
+	require.False(t, Accepts(header, Gzip))
+
+	header.Set("Accept-Encoding", "gzip, deflate")
+	require.True(t, Accepts(header, Gzip))
+	require.False(t, Accepts(header, Zstd))
+
+	header.Set("Accept-Encoding", "zstd;q=0, *")
+	require.False(t, Accepts(header, Zstd))
+	require.True(t, Accepts(header, Gzip))
+}
@@ -0,0 +1,51 @@
+package engineapi
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Method prefixes of the Engine API calls the proxy reads, all versions share the prefix
+const (
+	NewPayload        = "engine_newPayload"
+	ForkchoiceUpdated = "engine_forkchoiceUpdated"
+)
+
+// IsEngineRequest returns true for methods of the engine namespace
+func IsEngineRequest(method string) bool {
+	return strings.HasPrefix(method, "engine_")
+}
+
+// NewJSONRPCError returns a JSON-RPC error response
+func NewJSONRPCError(id any, code int, message string) []byte {
+	response, _ := json.Marshal(JSONRPCErrorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &JSONRPCError{Code: code, Message: message},
+	})
+	return response
+}
+
+// StripPayloadAttributes returns the forkchoiceUpdated request body with null payload attributes, so the execution
+// client only updates its head without building a block. Bodies without payload attributes are returned unchanged.
+func StripPayloadAttributes(body []byte) ([]byte, error) {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+	var params []json.RawMessage
+	if err := json.Unmarshal(request["params"], &params); err != nil {
+		return nil, err
+	}
+	if len(params) < 2 || string(params[1]) == "null" {
+		return body, nil
+	}
+
+	params[1] = json.RawMessage("null")
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	request["params"] = rawParams
+	return json.Marshal(request)
+}
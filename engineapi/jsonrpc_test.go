@@ -0,0 +1,25 @@
+package engineapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripPayloadAttributes(t *testing.T) {
+	body, err := StripPayloadAttributes([]byte(`{"jsonrpc":"2.0","method":"engine_forkchoiceUpdatedV3","params":[{"headBlockHash":"0x01"},{"timestamp":"0x1"}],"id":1}`))
+	require.NoError(t, err)
+	var request map[string]any
+	require.NoError(t, json.Unmarshal(body, &request))
+	require.Equal(t, []any{map[string]any{"headBlockHash": "0x01"}, nil}, request["params"])
+	require.Equal(t, float64(1), request["id"])
+
+	unchanged := []byte(`{"jsonrpc":"2.0","method":"engine_forkchoiceUpdatedV3","params":[{"headBlockHash":"0x01"},null],"id":1}`)
+	body, err = StripPayloadAttributes(unchanged)
+	require.NoError(t, err)
+	require.Equal(t, unchanged, body)
+
+	_, err = StripPayloadAttributes([]byte(`{"params":`))
+	require.Error(t, err)
+}
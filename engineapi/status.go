@@ -0,0 +1,75 @@
+package engineapi
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// ExtractStatus reads the payload status of a newPayload or forkchoiceUpdated response. Only the response up to
+// the status is read, the status is empty for error responses and other methods.
+func ExtractStatus(method string, response io.Reader) (string, error) {
+	var path []string
+	switch {
+	case strings.HasPrefix(method, NewPayload):
+		path = []string{"result", "status"}
+	case strings.HasPrefix(method, ForkchoiceUpdated):
+		path = []string{"result", "payloadStatus", "status"}
+	default:
+		return "", nil // not interested in other engine api calls
+	}
+
+	status, _, err := findString(json.NewDecoder(response), path)
+	return status, err
+}
+
+// findString reads the next JSON value and returns the string at the path of object keys in it
+func findString(decoder *json.Decoder, path []string) (string, bool, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", false, err
+	}
+	if len(path) == 0 {
+		s, ok := token.(string)
+		return s, ok, nil
+	}
+	if token != json.Delim('{') {
+		return "", false, skipValue(decoder, token)
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return "", false, err
+		}
+		if key == path[0] {
+			return findString(decoder, path[1:])
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return "", false, err
+		}
+	}
+	_, err = decoder.Token()
+	return "", false, err
+}
+
+// skipValue skips the rest of an array or object whose first token was already read
+func skipValue(decoder *json.Decoder, token json.Token) error {
+	if token != json.Delim('[') && token != json.Delim('{') {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('['), json.Delim('{'):
+			depth++
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
+	}
+	return nil
+}
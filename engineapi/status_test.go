@@ -0,0 +1,34 @@
+package engineapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractStatus(t *testing.T) {
+	status, err := ExtractStatus("engine_newPayloadV1", strings.NewReader(`{"jsonrpc":"2.0","id":1,"result":{"status":"VALID","latestValidHash":"0x3559e851470f6e7bbed1db474980683e8c315bfce99b2a6ef47c057c04de7858","validationError":""}}`))
+	require.NoError(t, err)
+	require.Equal(t, "VALID", status)
+
+	status, err = ExtractStatus("engine_forkchoiceUpdatedV1", strings.NewReader(`{"jsonrpc":"2.0","id":1,"result":{"payloadStatus":{"status":"VALID","latestValidHash":null,"validationError":null},"payloadId":null}}`))
+	require.NoError(t, err)
+	require.Equal(t, "VALID", status)
+
+	status, err = ExtractStatus("engine_getPayloadV3", strings.NewReader("not read"))
+	require.NoError(t, err)
+	require.Equal(t, "", status)
+
+	status, err = ExtractStatus("engine_newPayloadV1", strings.NewReader(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"error"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "", status)
+
+	// the rest of the response is not read
+	status, err = ExtractStatus("engine_forkchoiceUpdatedV1", strings.NewReader(`{"jsonrpc":"2.0","id":1,"result":{"payloadId":null,"payloadStatus":{"latestValidHash":null,"status":"SYNCING","valid`))
+	require.NoError(t, err)
+	require.Equal(t, "SYNCING", status)
+
+	_, err = ExtractStatus("engine_newPayloadV1", strings.NewReader(`{"result":`))
+	require.Error(t, err)
+}
@@ -1,4 +1,5 @@
-package main
+// Package engineapi contains the JSON-RPC types of the Engine API requests and responses the proxy reads
+package engineapi
 
 import (
 	"encoding/json"
@@ -21,6 +22,25 @@ type JSONRPCResponse struct {
 	Result  any    `json:"result"`
 }
 
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeMethodNotFound = -32601
+	CodeInternalError  = -32603
+	CodeServerError    = -32000
+)
+
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type JSONRPCErrorResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      any           `json:"id"`
+	Error   *JSONRPCError `json:"error"`
+}
+
 // PayloadID is an identifier of the payload build process
 type PayloadID [8]byte
 
@@ -48,7 +68,7 @@ func (req *JSONRPCRequest) UnmarshalJSON(data []byte) error {
 	}
 	var params []any
 	switch {
-	case strings.HasPrefix(msg.Method, fcU):
+	case strings.HasPrefix(msg.Method, ForkchoiceUpdated):
 		if err := json.Unmarshal(data, &requestParams); err != nil {
 			return err
 		}
@@ -65,7 +85,7 @@ func (req *JSONRPCRequest) UnmarshalJSON(data []byte) error {
 		}
 
 		params = append(params, &payloadAttributes)
-	case strings.HasPrefix(msg.Method, newPayload):
+	case strings.HasPrefix(msg.Method, NewPayload):
 		if err := json.Unmarshal(data, &requestParams); err != nil {
 			return err
 		}
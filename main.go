@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/flashbots/sync-proxy/beacon"
+	"github.com/flashbots/sync-proxy/proxy"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -19,15 +26,48 @@ var (
 	defaultLogJSON    = os.Getenv("LOG_JSON") != ""
 	defaultListenAddr = getEnv("PROXY_LISTEN_ADDR", "localhost:25590")
 	defaultTimeoutMs  = getEnvInt("BUILDER_TIMEOUT_MS", 2000) // timeout for all the requests to the builders
+	defaultRetries    = getEnvInt("BUILDER_RETRY_ATTEMPTS", 1)
 
 	// Flags
-	logJSON          = flag.Bool("json", defaultLogJSON, "log in JSON format instead of text")
-	logLevel         = flag.String("loglevel", defaultLogLevel, "log-level: trace, debug, info, warn/warning, error, fatal, panic")
-	listenAddr       = flag.String("addr", defaultListenAddr, "listen-address for builder proxy server")
-	builderURLs      = flag.String("builders", "", "builder urls - single entry or comma-separated list (scheme://host)")
-	builderTimeoutMs = flag.Int("request-timeout", defaultTimeoutMs, "timeout for requests to a builder [ms]")
-	proxyURLs        = flag.String("proxies", "", "proxy urls - other proxies to forward BN requests to (scheme://host)")
-	proxyTimeoutMs   = flag.Int("proxy-request-timeout", defaultTimeoutMs, "timeout for redundant beacon node requests to another proxy [ms]")
+	logJSON           = flag.Bool("json", defaultLogJSON, "log in JSON format instead of text")
+	logLevel          = flag.String("loglevel", defaultLogLevel, "log-level: trace, debug, info, warn/warning, error, fatal, panic")
+	listenAddr        = flag.String("addr", defaultListenAddr, "listen-address for builder proxy server (host:port or unix:///path/to/proxy.sock), comma-separated for multiple addresses")
+	tlsCertFile       = flag.String("tls-cert", "", "certificate file to serve the listener with TLS")
+	tlsKeyFile        = flag.String("tls-key", "", "key file to serve the listener with TLS")
+	tlsClientCAFile   = flag.String("tls-client-ca", "", "CA bundle to require and verify client certificates on the listener")
+	jwtSecretFile     = flag.String("jwt-secret", "", "path to the hex encoded JWT secret, used to sign requests to the builders from WebSocket connections")
+	builderURLs       = flag.String("builders", "", "builder urls - single entry or comma-separated list (scheme://host or unix:///path/to/engine.sock)")
+	builderTimeoutMs  = flag.Int("request-timeout", defaultTimeoutMs, "timeout for requests to a builder [ms]")
+	maxResponseSize   = flag.Int64("max-response-size", 128<<20, "max size of a builder response body, larger responses are treated as failed [bytes], 0 for no limit")
+	clientCancel      = flag.String("client-cancel", proxy.ClientCancelOff, "builder requests cancelled when the beacon node cancels its request: off, primary or all")
+	methodTimeoutsMs  = flag.String("method-timeouts", "", "comma-separated timeouts for requests to a builder by method prefix, e.g. engine_newPayload=8000,engine_forkchoiceUpdated=2000 [ms]")
+	proxyURLs         = flag.String("proxies", "", "proxy urls - other proxies to forward BN requests to (scheme://host)")
+	proxyTimeoutMs    = flag.Int("proxy-request-timeout", defaultTimeoutMs, "timeout for redundant beacon node requests to another proxy [ms]")
+	proxyWorkers      = flag.Int("proxy-workers", 4, "number of concurrent requests to each proxy")
+	proxyQueueSize    = flag.Int("proxy-queue-size", 64, "max number of requests waiting to be forwarded to each proxy")
+	proxyWaitMs       = flag.Int("proxy-wait", 50, "max time a request waits for space in the queues of all proxies together before it is dropped [ms]")
+	allowBeacons      = flag.String("allow-beacons", "", "comma-separated CIDRs or IPs allowed to send requests as beacon nodes, all if empty")
+	denyBeacons       = flag.String("deny-beacons", "", "comma-separated CIDRs or IPs denied to send requests as beacon nodes")
+	allowProxies      = flag.String("allow-proxies", "", "comma-separated CIDRs or IPs allowed to forward requests as other proxies, requests from other sources are checked as beacon requests")
+	denyProxies       = flag.String("deny-proxies", "", "comma-separated CIDRs or IPs denied to forward requests as other proxies, their requests with the via header are rejected")
+	trustedProxies    = flag.String("trusted-proxies", "", "comma-separated CIDRs or IPs of proxies in front of this proxy, e.g. nginx, whose X-Forwarded-For and X-Real-IP headers identify the beacon node")
+	rateLimit         = flag.Float64("rate-limit", 0, "max requests per second per source IP, 0 for no limit")
+	rateBurst         = flag.Int("rate-burst", 20, "max burst of requests per source IP")
+	instanceID        = flag.String("instance-id", "", "id of this proxy in the via header of requests forwarded to other proxies, random if empty")
+	maxHops           = flag.Int("max-hops", 4, "requests which passed through this many proxies are not forwarded to other proxies, 0 for no limit")
+	configFile        = flag.String("config", "", "path to an optional JSON config file with per-builder settings")
+	retryAttempts     = flag.Int("retry-attempts", defaultRetries, "max attempts for a request to a builder, retried on network errors and 502/503 responses, 1 for no retries")
+	retryBackoffMs    = flag.Int("retry-backoff", 100, "initial backoff between retries to a builder, doubled after each attempt [ms]")
+	retryMaxBackoffMs = flag.Int("retry-max-backoff", 1000, "max backoff between retries to a builder [ms]")
+	preferredGroup    = flag.String("preferred-group", "", "builder group the response to the beacon node is taken from, the group of the first builder if empty")
+	queueSize         = flag.Int("queue-size", 1024, "max number of requests queued for an async builder")
+	queueDir          = flag.String("queue-dir", "", "directory for the write-ahead logs of async builder queues, queues are only kept in memory if empty")
+	otelEndpoint      = flag.String("otel-endpoint", "", "OTLP HTTP endpoint to export traces to, e.g. http://localhost:4318, no tracing if empty")
+	otelServiceName   = flag.String("otel-service-name", "sync-proxy", "service name of the exported traces")
+	otelSampleRatio   = flag.Float64("otel-sample-ratio", 1, "ratio of beacon node requests to trace, requests traced by another proxy are always traced")
+	chaosConfigFile   = flag.String("chaos-config", "", "path to a JSON file with faults to inject into builder requests, for testing only")
+	chaosAdminAddr    = flag.String("chaos-admin-addr", "", "listen address of the admin API to change the injected faults at runtime, for testing only, e.g. localhost:25591")
+	chaosAdminRemote  = flag.Bool("chaos-admin-allow-remote", false, "allow the unauthenticated chaos admin API to listen on a non-loopback address")
 )
 
 var log = logrus.WithField("module", "sync-proxy")
@@ -56,35 +96,159 @@ func main() {
 	log.Infof("sync-proxy %s", version)
 
 	builders := parseURLs(*builderURLs)
+	var builderConfigs map[string]*proxy.BuilderConfig
+	var routes []proxy.RouteConfig
+	if *configFile != "" {
+		config, err := proxy.LoadConfig(*configFile)
+		if err != nil {
+			log.WithError(err).Fatal("failed loading the config file")
+		}
+		builders, builderConfigs = mergeBuilderConfigs(builders, config.Builders)
+		routes = config.Routes
+	}
 	if len(builders) == 0 {
 		log.Fatal("No builder urls specified")
 	}
 	log.WithField("builders", builders).Infof("using %d builders", len(builders))
 
 	builderTimeout := time.Duration(*builderTimeoutMs) * time.Millisecond
+	methodTimeouts, err := proxy.ParseMethodTimeouts(*methodTimeoutsMs)
+	if err != nil {
+		log.WithError(err).Fatal("invalid method timeouts")
+	}
+
+	retry := proxy.RetryConfig{
+		MaxAttempts:    *retryAttempts,
+		InitialBackoff: proxy.Duration(time.Duration(*retryBackoffMs) * time.Millisecond),
+		MaxBackoff:     proxy.Duration(time.Duration(*retryMaxBackoffMs) * time.Millisecond),
+	}
+
+	var jwtSecret []byte
+	if *jwtSecretFile != "" {
+		var err error
+		jwtSecret, err = proxy.LoadJWTSecret(*jwtSecretFile)
+		if err != nil {
+			log.WithError(err).Fatal("failed loading the JWT secret")
+		}
+	}
+
+	beaconACL, err := proxy.NewACL(*allowBeacons, *denyBeacons)
+	if err != nil {
+		log.WithError(err).Fatal("invalid beacon access control list")
+	}
+	proxyACL, err := proxy.NewACL(*allowProxies, *denyProxies)
+	if err != nil {
+		log.WithError(err).Fatal("invalid proxy access control list")
+	}
+
+	trustedProxyList, err := beacon.ParseIPList(*trustedProxies)
+	if err != nil {
+		log.WithError(err).Fatal("invalid trusted proxies")
+	}
 
 	proxies := parseURLs(*proxyURLs)
 	log.WithField("proxies", proxies).Infof("using %d proxies", len(proxies))
 
 	proxyTimeout := time.Duration(*proxyTimeoutMs) * time.Millisecond
 
+	var tracerProvider trace.TracerProvider
+	if *otelEndpoint != "" {
+		provider, err := proxy.NewTracerProvider(context.Background(), *otelEndpoint, *otelServiceName, *otelSampleRatio)
+		if err != nil {
+			log.WithError(err).Fatal("failed creating the OTLP exporter")
+		}
+		tracerProvider = provider
+		log.WithField("endpoint", *otelEndpoint).Info("exporting traces")
+
+		// flush the batched spans on exit, log.Fatal runs the exit handlers as well
+		logrus.RegisterExitHandler(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := provider.Shutdown(ctx); err != nil {
+				log.WithError(err).Error("failed to flush traces")
+			}
+		})
+	}
+
+	var chaos *proxy.Chaos
+	if *chaosConfigFile != "" || *chaosAdminAddr != "" {
+		var chaosConfig *proxy.ChaosConfig
+		if *chaosConfigFile != "" {
+			chaosConfig, err = proxy.LoadChaosConfig(*chaosConfigFile)
+			if err != nil {
+				log.WithError(err).Fatal("failed loading the chaos config")
+			}
+		}
+		chaos = proxy.NewChaos(chaosConfig, log.WithField("chaos", true))
+		log.Warn("fault injection into builder requests is enabled")
+
+		if *chaosAdminAddr != "" {
+			if err := proxy.CheckChaosAdminAddr(*chaosAdminAddr, *chaosAdminRemote); err != nil {
+				log.WithError(err).Fatal("refusing to serve the chaos admin API")
+			}
+			go func() {
+				log.WithField("addr", *chaosAdminAddr).Info("serving the chaos admin API")
+				log.WithError(http.ListenAndServe(*chaosAdminAddr, chaos)).Fatal("chaos admin API failed")
+			}()
+		}
+	}
+
 	// Create a new proxy service.
-	opts := ProxyServiceOpts{
-		ListenAddr:     *listenAddr,
-		Builders:       builders,
-		BuilderTimeout: builderTimeout,
-		Proxies:        proxies,
-		ProxyTimeout:   proxyTimeout,
-		Log:            log,
+	opts := proxy.ProxyServiceOpts{
+		ListenAddr:      *listenAddr,
+		TLSCertFile:     *tlsCertFile,
+		TLSKeyFile:      *tlsKeyFile,
+		TLSClientCAFile: *tlsClientCAFile,
+		Builders:        builders,
+		BuilderTimeout:  builderTimeout,
+		MethodTimeouts:  methodTimeouts,
+		ClientCancel:    *clientCancel,
+		MaxResponseSize: *maxResponseSize,
+		BuilderConfigs:  builderConfigs,
+		PreferredGroup:  *preferredGroup,
+		Routes:          routes,
+		Retry:           retry,
+		QueueSize:       *queueSize,
+		QueueDir:        *queueDir,
+		Proxies:         proxies,
+		ProxyTimeout:    proxyTimeout,
+		ProxyWorkers:    *proxyWorkers,
+		ProxyQueueSize:  *proxyQueueSize,
+		ProxyWait:       time.Duration(*proxyWaitMs) * time.Millisecond,
+		JWTSecret:       jwtSecret,
+		BeaconACL:       beaconACL,
+		ProxyACL:        proxyACL,
+		TrustedProxies:  trustedProxyList,
+		RateLimit:       *rateLimit,
+		RateBurst:       *rateBurst,
+		InstanceID:      *instanceID,
+		MaxHops:         *maxHops,
+		TracerProvider:  tracerProvider,
+		Chaos:           chaos,
+		Log:             log,
 	}
 
-	proxyService, err := NewProxyService(opts)
+	proxyService, err := proxy.NewProxyService(opts)
 	if err != nil {
 		log.WithError(err).Fatal("failed creating the server")
 	}
 
+	// stop the server on SIGINT and SIGTERM, then exit through the exit handlers
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	closed := make(chan struct{})
+	go func() {
+		log.WithField("signal", <-signals).Info("shutting down")
+		proxyService.Close()
+		close(closed)
+	}()
+
 	log.Println("listening on", *listenAddr)
-	log.Fatal(proxyService.StartHTTPServer())
+	if err := proxyService.StartHTTPServer(); err != nil {
+		log.WithError(err).Fatal("server failed")
+	}
+	<-closed
+	logrus.Exit(0)
 }
 
 func getEnv(key string, defaultValue string) string {
@@ -112,13 +276,7 @@ func parseURLs(urls string) []*url.URL {
 			continue
 		}
 
-		// Add protocol scheme prefix if it does not exist.
-		if !strings.HasPrefix(rawURL, "http") {
-			rawURL = "http://" + rawURL
-		}
-
-		// Parse the provided URL.
-		url, err := url.ParseRequestURI(rawURL)
+		url, err := proxy.ParseURL(rawURL)
 		if err != nil {
 			log.WithError(err).WithField("url", entry).Fatal("Invalid URL")
 		}
@@ -127,3 +285,31 @@ func parseURLs(urls string) []*url.URL {
 	}
 	return ret
 }
+
+// mergeBuilderConfigs adds the builders from the config file which are not passed as flag and
+// returns the builder configs keyed by the builder url
+func mergeBuilderConfigs(builders []*url.URL, configs []proxy.BuilderConfig) ([]*url.URL, map[string]*proxy.BuilderConfig) {
+	builderConfigs := make(map[string]*proxy.BuilderConfig, len(configs))
+	for i, config := range configs {
+		url, err := proxy.ParseURL(config.URL)
+		if err != nil {
+			log.WithError(err).WithField("url", config.URL).Fatal("Invalid URL in config file")
+		}
+		if _, ok := builderConfigs[url.String()]; ok {
+			log.WithField("url", config.URL).Fatal("Duplicate builder in config file")
+		}
+		builderConfigs[url.String()] = &configs[i]
+
+		found := false
+		for _, builder := range builders {
+			if builder.String() == url.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			builders = append(builders, url)
+		}
+	}
+	return builders, builderConfigs
+}
@@ -1,7 +1,7 @@
-package main
+package mocks
 
 var (
-	mockNewPayloadRequest = `{
+	NewPayloadRequest = `{
 		"jsonrpc": "2.0",
 		"method": "engine_newPayloadV1",
 		"params": [
@@ -24,7 +24,7 @@ var (
 		],
 		"id": 67
 	}`
-	mockNewPayloadResponseValid = `{
+	NewPayloadResponseValid = `{
 		"jsonrpc": "2.0",
 		"id": 67,
 		"result": {
@@ -33,7 +33,7 @@ var (
 		  "validationError": ""
 		}
 	}`
-	mockNewPayloadResponseSyncing = `{
+	NewPayloadResponseSyncing = `{
 		"jsonrpc": "2.0",
 		"id": 67,
 		"result": {
@@ -42,7 +42,7 @@ var (
 		  "validationError": ""
 		}
 	}`
-	mockForkchoiceRequestWithPayloadAttributesV1 = `{
+	ForkchoiceRequestWithPayloadAttributesV1 = `{
 		"jsonrpc": "2.0",
 		"method": "engine_forkchoiceUpdatedV1",
 		"params": [
@@ -59,7 +59,7 @@ var (
 		],
 		"id": 67
 	}`
-	mockForkchoiceRequestWithPayloadAttributesV2 = `{
+	ForkchoiceRequestWithPayloadAttributesV2 = `{
 		"jsonrpc": "2.0",
 		"method": "engine_forkchoiceUpdatedV1",
 		"params": [
@@ -84,7 +84,7 @@ var (
 		],
 		"id": 67
 	}`
-	mockForkchoiceRequest = `{
+	ForkchoiceRequest = `{
 		"jsonrpc": "2.0",
 		"method": "engine_forkchoiceUpdatedV1",
 		"params": [
@@ -97,7 +97,7 @@ var (
 		],
 		"id": 67
 	}`
-	mockForkchoiceResponse = `{
+	ForkchoiceResponse = `{
 		"jsonrpc": "2.0",
 		"id": 67,
 		"result": {
@@ -109,13 +109,13 @@ var (
 		  "payloadId": null
 		}
 	}`
-	mockTransitionRequest = `{
+	TransitionRequest = `{
 		"jsonrpc": "2.0",
 		"method": "engine_exchangeTransitionConfigurationV1",
 		"params": ["0x12309ce54000", "0x0000000000000000000000000000000000000000000000000000000000000000", "0x0"],
 		"id": 1
 	}`
-	mockTransitionResponse = `{
+	TransitionResponse = `{
 		"jsonrpc": "2.0",
 		"id": 1,
 		"result": {
@@ -124,5 +124,5 @@ var (
 			"terminalBlockNumber": "0x0"
 		}
 	}`
-	mockEthChainIDRequest = `{"jsonrpc":"2.0","method":"eth_chainId","id":1}`
+	EthChainIDRequest = `{"jsonrpc":"2.0","method":"eth_chainId","id":1}`
 )
@@ -0,0 +1,140 @@
+package mocks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+// Server is used to fake a builder's / proxy's behavior.
+type Server struct {
+	// Used to panic if impossible error happens
+	t *testing.T
+
+	// Used to count each engine made to the service, either if it fails or not, for each method
+	mu           sync.Mutex
+	requestCount map[string]int
+	requestIDs   []int
+	lastHeader   http.Header
+
+	// Responses placeholders that can be overridden
+	Response []byte
+
+	// Number of requests answered with 503 before responding normally
+	NumFailures int
+
+	// Content-Encoding of the responses, if empty the response is sent uncompressed
+	ResponseEncoding string
+
+	// Server section
+	Server        *httptest.Server
+	ResponseDelay time.Duration
+}
+
+// NewServer creates a mocked service like builder / proxy
+func NewServer(t *testing.T) *Server {
+	service := &Server{t: t, requestCount: make(map[string]int)}
+
+	// Initialize server
+	service.Server = httptest.NewServer(service.Handler())
+
+	return service
+}
+
+// Handler registers the backend, apply the test middleware and returns the router
+func (m *Server) Handler() http.Handler {
+	// Create router.
+	r := mux.NewRouter()
+
+	// Register handlers
+	r.HandleFunc("/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		m.mu.Lock()
+		fail := m.NumFailures > 0
+		if fail {
+			m.NumFailures--
+		}
+		m.mu.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		response := m.Response
+		if m.ResponseEncoding != "" {
+			var err error
+			response, err = compression.Encode(m.ResponseEncoding, response)
+			require.NoError(m.t, err)
+			w.Header().Set("Content-Encoding", m.ResponseEncoding)
+		}
+
+		w.WriteHeader(200)
+		w.Write(response)
+	})).Methods(http.MethodPost)
+
+	return m.newTestMiddleware(r)
+}
+
+// newTestMiddleware creates a middleware which increases the Request counter and creates a fake delay for the response
+func (m *Server) newTestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			// Request counter
+			m.mu.Lock()
+
+			bodyBytes, err := io.ReadAll(r.Body)
+			require.NoError(m.t, err)
+			bodyBytes, err = compression.Decode(r.Header.Get("Content-Encoding"), bodyBytes)
+			require.NoError(m.t, err)
+
+			var req engineapi.JSONRPCRequest
+			err = json.Unmarshal(bodyBytes, &req)
+			require.NoError(m.t, err)
+			m.requestCount[req.Method]++
+			m.requestIDs = append(m.requestIDs, req.ID)
+			m.lastHeader = r.Header.Clone()
+
+			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+			m.mu.Unlock()
+
+			// Artificial Delay
+			if m.ResponseDelay > 0 {
+				time.Sleep(m.ResponseDelay)
+			}
+
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+// GetRequestCount returns the number of requests made to an api method
+func (m *Server) GetRequestCount(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requestCount[method]
+}
+
+// GetRequestIDs returns the JSON-RPC ids of all requests in the order they were received
+func (m *Server) GetRequestIDs() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int(nil), m.requestIDs...)
+}
+
+// GetLastHeader returns the headers of the last request
+func (m *Server) GetLastHeader() http.Header {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastHeader
+}
@@ -1,4 +1,4 @@
-package main
+package mocks
 
 import (
 	"bytes"
@@ -11,14 +11,14 @@ import (
 
 func Test_mockBuilder(t *testing.T) {
 	t.Run("test payload", func(t *testing.T) {
-		builder := newMockServer(t)
+		builder := NewServer(t)
 
-		builder.Response = []byte(mockNewPayloadResponseValid)
+		builder.Response = []byte(NewPayloadResponseValid)
 
-		req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(mockNewPayloadRequest)))
+		req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(NewPayloadRequest)))
 		require.NoError(t, err)
 		rr := httptest.NewRecorder()
-		builder.getRouter().ServeHTTP(rr, req)
+		builder.Handler().ServeHTTP(rr, req)
 		require.Equal(t, http.StatusOK, rr.Code)
 		require.Equal(t, 1, builder.requestCount["engine_newPayloadV1"])
 	})
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/flashbots/sync-proxy/beacon"
+)
+
+// ACL is an access control list of sources allowed to send requests to the proxy
+type ACL struct {
+	Allow beacon.IPList // if not empty, only these sources are allowed
+	Deny  beacon.IPList // these sources are denied, even if they are allowed
+}
+
+// NewACL parses comma-separated allow and deny lists of CIDRs and addresses
+func NewACL(allow, deny string) (ACL, error) {
+	allowList, err := beacon.ParseIPList(allow)
+	if err != nil {
+		return ACL{}, err
+	}
+	denyList, err := beacon.ParseIPList(deny)
+	if err != nil {
+		return ACL{}, err
+	}
+	return ACL{Allow: allowList, Deny: denyList}, nil
+}
+
+func (a ACL) allows(addr netip.Addr) bool {
+	if a.Deny.Contains(addr) {
+		return false
+	}
+	return len(a.Allow) == 0 || a.Allow.Contains(addr)
+}
+
+// getClientIP returns the address of the client which sent the request, false if the request wasn't
+// received over TCP, e.g. on a unix domain socket
+func (p *ProxyService) getClientIP(req *http.Request) (netip.Addr, bool) {
+	return beacon.ParseIP(beacon.RemoteHost(req, p.trustedProxies))
+}
+
+// isFromProxy returns true if the request was forwarded by another proxy. The via header can be sent by
+// anyone, so only sources explicitly allowed as proxies are trusted with it.
+func (p *ProxyService) isFromProxy(req *http.Request) bool {
+	if len(getVia(req.Header)) == 0 || len(p.proxyACL.Allow) == 0 {
+		return false
+	}
+	addr, ok := beacon.ParseIP(beacon.RemoteAddrHost(req.RemoteAddr))
+	return ok && p.proxyACL.allows(addr)
+}
+
+// isDeniedProxy returns true if the request has the via header and its source is denied as proxy
+func (p *ProxyService) isDeniedProxy(req *http.Request) bool {
+	if len(getVia(req.Header)) == 0 {
+		return false
+	}
+	addr, ok := beacon.ParseIP(beacon.RemoteAddrHost(req.RemoteAddr))
+	return ok && p.proxyACL.Deny.Contains(addr)
+}
+
+// checkAccess returns the HTTP status and an error if the source of the request is not allowed by the ACL,
+// or exceeds its rate limit. Requests forwarded by other proxies are checked against the proxy ACL, all
+// others against the beacon ACL. Denied proxies are rejected whatever the beacon ACL allows.
+func (p *ProxyService) checkAccess(req *http.Request) (int, error) {
+	if p.isDeniedProxy(req) {
+		return p.rejectACL(req)
+	}
+	if p.isFromProxy(req) {
+		// other proxies are checked by their own address, not the beacon node they forward for
+		if err := p.checkRateLimit(req); err != nil {
+			return http.StatusTooManyRequests, err
+		}
+		return http.StatusOK, nil
+	}
+
+	acl := p.beaconACL
+	addr, ok := p.getClientIP(req)
+	if !ok {
+		// access to unix domain sockets is controlled by file permissions
+		return http.StatusOK, nil
+	}
+
+	if !acl.allows(addr) {
+		return p.rejectACL(req)
+	}
+
+	if err := p.checkRateLimit(req); err != nil {
+		return http.StatusTooManyRequests, err
+	}
+	return http.StatusOK, nil
+}
+
+// rejectACL counts and logs a request rejected by an ACL
+func (p *ProxyService) rejectACL(req *http.Request) (int, error) {
+	p.numRejectedACL.Add(1)
+	p.log.WithField("remoteAddr", req.RemoteAddr).Warn("request rejected by access control list")
+	return http.StatusForbidden, errAccessDenied
+}
+
+// checkRateLimit returns an error if the source of the request exceeds its rate limit
+func (p *ProxyService) checkRateLimit(req *http.Request) error {
+	addr, ok := p.getClientIP(req)
+	if !ok || p.rateLimiter.allow(addr.String()) {
+		return nil
+	}
+
+	p.numRejectedRateLimit.Add(1)
+	p.log.WithField("remoteAddr", req.RemoteAddr).Warn("request rejected by rate limit")
+	return errRateLimited
+}
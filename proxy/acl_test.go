@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACL(t *testing.T) {
+	acl, err := NewACL("10.0.0.0/8, 192.168.1.1", "10.1.0.0/16")
+	require.NoError(t, err)
+
+	require.True(t, acl.allows(netip.MustParseAddr("10.0.0.1")))
+	require.True(t, acl.allows(netip.MustParseAddr("192.168.1.1")))
+	require.True(t, acl.allows(netip.MustParseAddr("::ffff:10.0.0.1")))
+	require.False(t, acl.allows(netip.MustParseAddr("192.168.1.2")))
+	require.False(t, acl.allows(netip.MustParseAddr("10.1.2.3")))
+
+	acl, err = NewACL("", "fd00::/8")
+	require.NoError(t, err)
+	require.True(t, acl.allows(netip.MustParseAddr("10.0.0.1")))
+	require.False(t, acl.allows(netip.MustParseAddr("fd00::1")))
+
+	acl, err = NewACL("fe80::/10", "")
+	require.NoError(t, err)
+	require.True(t, acl.allows(netip.MustParseAddr("fe80::1%eth0")))
+	require.False(t, acl.allows(netip.MustParseAddr("2001:db8::1")))
+
+	_, err = NewACL("10.0.0.0/33", "")
+	require.Error(t, err)
+	_, err = NewACL("", "not-an-ip")
+	require.Error(t, err)
+}
+
+func TestAccessControl(t *testing.T) {
+	requireRejected := func(t *testing.T, rr *httptest.ResponseRecorder, status int) {
+		require.Equal(t, status, rr.Code, rr.Body.String())
+		var response engineapi.JSONRPCErrorResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		require.NotNil(t, response.Error)
+	}
+
+	t.Run("should reject beacon requests not allowed by the ACL", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.beaconACL, _ = NewACL("192.168.0.0/16", "")
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		requireRejected(t, rr, http.StatusForbidden)
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+
+		rr = backend.request(t, []byte(mocks.NewPayloadRequest), "192.168.0.1:1234")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, uint64(1), backend.proxyService.Stats().RejectedACL)
+	})
+
+	requestVia := func(backend *testBackend, from string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		req.RemoteAddr = from
+		req.Header.Set(viaHeader, "other-proxy")
+		rr := httptest.NewRecorder()
+		backend.proxyService.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should check requests from other proxies against the proxy ACL", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.beaconACL, _ = NewACL("192.168.0.0/16", "")
+		backend.proxyService.proxyACL, _ = NewACL("10.0.0.0/8", "10.1.0.0/16")
+
+		rr := requestVia(backend, from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+
+		rr = requestVia(backend, "10.1.0.1:1234")
+		requireRejected(t, rr, http.StatusForbidden)
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should reject denied proxies even if the beacon ACL allows them", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.proxyACL, _ = NewACL("", "10.0.0.0/8")
+
+		rr := requestVia(backend, from)
+		requireRejected(t, rr, http.StatusForbidden)
+
+		backend.proxyService.proxyACL, _ = NewACL("10.0.0.0/8", "10.0.0.0/24")
+		rr = requestVia(backend, from)
+		requireRejected(t, rr, http.StatusForbidden)
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+
+		// without the via header the source is checked as a beacon node
+		rr = backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+
+	t.Run("should not trust the via header of sources which are not allowed as proxies", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.beaconACL, _ = NewACL("", "10.0.0.0/8")
+
+		rr := requestVia(backend, from)
+		requireRejected(t, rr, http.StatusForbidden)
+
+		backend.proxyService.proxyACL, _ = NewACL("192.168.0.0/16", "")
+		rr = requestVia(backend, from)
+		requireRejected(t, rr, http.StatusForbidden)
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should rate limit requests per source", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.rateLimiter = newRateLimiter(0.001, 2)
+
+		for i := 0; i < 2; i++ {
+			rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		}
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		requireRejected(t, rr, http.StatusTooManyRequests)
+
+		// other sources have their own limit
+		rr = backend.request(t, []byte(mocks.NewPayloadRequest), "10.0.0.1:1234")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		require.Equal(t, 3, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, uint64(1), backend.proxyService.Stats().RejectedRateLimit)
+	})
+}
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/engineapi"
+)
+
+// Backend sends requests to a builder or proxy. The request is built for the beacon node's request, with the
+// body already encoded with the builder's request encoding, and the backend is responsible for delivering it.
+type Backend interface {
+	Send(ctx context.Context, req *http.Request) (*http.Response, error)
+}
+
+// newBackend returns the backend for the url: WebSocket for ws and wss, a NullBackend for null and HTTP for
+// everything else including unix domain sockets
+func newBackend(u *url.URL, timeout time.Duration, tlsConfig *tls.Config) Backend {
+	switch u.Scheme {
+	case "ws", "wss":
+		return NewWebSocketBackend(u, timeout, tlsConfig)
+	case "null":
+		return NullBackend{}
+	default:
+		return NewHTTPBackend(u, timeout, tlsConfig)
+	}
+}
+
+// HTTPBackend sends requests over HTTP, or HTTP over a unix domain socket for unix urls
+type HTTPBackend struct {
+	proxy *httputil.ReverseProxy
+}
+
+// NewHTTPBackend creates a backend for the http, https or unix url
+func NewHTTPBackend(u *url.URL, timeout time.Duration, tlsConfig *tls.Config) *HTTPBackend {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: timeout,
+	}
+	targetURL := u
+	dialContext := dialer.DialContext
+	if u.Scheme == "unix" {
+		// HTTP over the unix domain socket at the url's path
+		targetURL = &url.URL{Scheme: "http", Host: "localhost"}
+		dialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", u.Path)
+		}
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	proxy.Transport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &HTTPBackend{proxy: proxy}
+}
+
+func (b *HTTPBackend) Send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	req = req.Clone(ctx)
+	b.proxy.Director(req)
+	return b.proxy.Transport.RoundTrip(req)
+}
+
+// HandlerBackend sends requests to an http.Handler in the same process, e.g. an embedded execution client
+type HandlerBackend struct {
+	Handler http.Handler
+}
+
+func (b HandlerBackend) Send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	w := &responseBuffer{header: http.Header{}}
+	b.Handler.ServeHTTP(w, req.Clone(ctx))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return newResponse(req, w.statusCode, w.header, w.body.Bytes()), nil
+}
+
+// responseBuffer keeps the response of a HandlerBackend
+type responseBuffer struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (w *responseBuffer) Header() http.Header {
+	return w.header
+}
+
+func (w *responseBuffer) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *responseBuffer) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+// Flush does nothing, the response is only used once it is complete
+func (w *responseBuffer) Flush() {}
+
+// NullBackend answers newPayload and forkchoiceUpdated with SYNCING without sending the request anywhere,
+// other methods get a method not found error
+type NullBackend struct{}
+
+func (NullBackend) Send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var request struct {
+		Method string `json:"method"`
+		ID     int    `json:"id"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return newResponse(req, http.StatusOK, jsonHeader(), engineapi.NewJSONRPCError(nil, engineapi.CodeParseError, err.Error())), nil
+	}
+
+	syncing := engineapi.PayloadStatusV1{Status: "SYNCING"}
+	var result any
+	switch {
+	case strings.HasPrefix(request.Method, engineapi.NewPayload):
+		result = syncing
+	case strings.HasPrefix(request.Method, engineapi.ForkchoiceUpdated):
+		result = engineapi.ForkChoiceResponse{PayloadStatus: syncing}
+	default:
+		message := fmt.Sprintf("the method %s does not exist/is not available", request.Method)
+		return newResponse(req, http.StatusOK, jsonHeader(), engineapi.NewJSONRPCError(request.ID, engineapi.CodeMethodNotFound, message)), nil
+	}
+
+	response, err := json.Marshal(engineapi.JSONRPCResponse{JSONRPC: "2.0", ID: request.ID, Result: result})
+	if err != nil {
+		return nil, err
+	}
+	return newResponse(req, http.StatusOK, jsonHeader(), response), nil
+}
+
+// RecordingBackend writes the requests sent to it as JSON lines and passes them on to Next, or answers them
+// like a NullBackend if Next is nil
+type RecordingBackend struct {
+	Next Backend
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecordingBackend creates a backend recording requests to w
+func NewRecordingBackend(w io.Writer, next Backend) *RecordingBackend {
+	return &RecordingBackend{Next: next, w: w}
+}
+
+// recordedRequest is a line written by the RecordingBackend
+type recordedRequest struct {
+	Time    time.Time       `json:"time"`
+	Request json.RawMessage `json:"request"`
+}
+
+func (b *RecordingBackend) Send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	line, err := json.Marshal(recordedRequest{Time: time.Now().UTC(), Request: body})
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	_, err = b.w.Write(append(line, '\n'))
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	next := b.Next
+	if next == nil {
+		next = NullBackend{}
+	}
+	return next.Send(ctx, req)
+}
+
+// readRequestBody returns the uncompressed request body, the request keeps its body for other backends
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return compression.Decode(req.Header.Get("Content-Encoding"), body)
+}
+
+func newResponse(req *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": []string{"application/json"}}
+}
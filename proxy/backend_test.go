@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func sendBackendRequest(t *testing.T, backend Backend, body string) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := backend.Send(context.Background(), req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestNullBackend(t *testing.T) {
+	resp := sendBackendRequest(t, NullBackend{}, mocks.NewPayloadRequest)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	status, err := engineapi.ExtractStatus(newPayloadPath, resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "SYNCING", status)
+
+	resp = sendBackendRequest(t, NullBackend{}, mocks.ForkchoiceRequest)
+	var response struct {
+		ID     int                          `json:"id"`
+		Result engineapi.ForkChoiceResponse `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	require.Equal(t, "SYNCING", response.Result.PayloadStatus.Status)
+	require.Nil(t, response.Result.PayloadID)
+
+	resp = sendBackendRequest(t, NullBackend{}, mocks.EthChainIDRequest)
+	var errorResponse engineapi.JSONRPCErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorResponse))
+	require.Equal(t, engineapi.CodeMethodNotFound, errorResponse.Error.Code)
+}
+
+func TestRecordingBackend(t *testing.T) {
+	var buf bytes.Buffer
+	builder := mocks.NewServer(t)
+	builder.Response = []byte(mocks.NewPayloadResponseValid)
+	backend := NewRecordingBackend(&buf, HandlerBackend{Handler: builder.Handler()})
+
+	resp := sendBackendRequest(t, backend, mocks.NewPayloadRequest)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, mocks.NewPayloadResponseValid, string(body))
+	require.Equal(t, 1, builder.GetRequestCount(newPayloadPath))
+
+	var recorded recordedRequest
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &recorded))
+	require.JSONEq(t, mocks.NewPayloadRequest, string(recorded.Request))
+	require.WithinDuration(t, time.Now(), recorded.Time, time.Second)
+}
+
+func TestBackends(t *testing.T) {
+	t.Run("should send requests to the backends of the builders", func(t *testing.T) {
+		inProcess := mocks.NewServer(t)
+		inProcess.Response = []byte(mocks.NewPayloadResponseValid)
+		builders := []*url.URL{{Scheme: "inprocess", Host: "el"}, {Scheme: "null", Host: "sink"}}
+
+		service, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			Builders:       builders,
+			BuilderTimeout: time.Second,
+			Backends:       map[string]Backend{"inprocess://el": HandlerBackend{Handler: inProcess.Handler()}},
+		})
+		require.NoError(t, err)
+		backend := &testBackend{proxyService: service}
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, mocks.NewPayloadResponseValid, rr.Body.String())
+		require.Equal(t, 1, inProcess.GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should send requests to builders over WebSocket", func(t *testing.T) {
+		// the WebSocket endpoint of another proxy in front of the builder
+		wsBackend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		server := httptest.NewServer(wsBackend.proxyService)
+		defer server.Close()
+
+		builderURL, err := ParseURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		require.NoError(t, err)
+		service, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			Builders:       []*url.URL{builderURL},
+			BuilderTimeout: time.Second,
+		})
+		require.NoError(t, err)
+		defer service.Close()
+		backend := &testBackend{proxyService: service}
+
+		for i := 0; i < 2; i++ {
+			rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			require.JSONEq(t, mocks.NewPayloadResponseValid, rr.Body.String())
+		}
+		require.Equal(t, 2, wsBackend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, uint64(1), wsBackend.proxyService.numWebSocketConns.Load())
+	})
+}
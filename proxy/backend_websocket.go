@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var errUnexpectedMessage = errors.New("unexpected WebSocket message type")
+
+// WebSocketBackend sends requests as messages over a WebSocket connection. Requests are sent one at a time,
+// so each response is the answer to the request before it. The connection is opened with the Authorization
+// header of the first request and reopened after an error.
+type WebSocketBackend struct {
+	url    *url.URL
+	dialer *websocket.Dialer
+
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+// NewWebSocketBackend creates a backend for the ws or wss url
+func NewWebSocketBackend(u *url.URL, timeout time.Duration, tlsConfig *tls.Config) *WebSocketBackend {
+	return &WebSocketBackend{
+		url: u,
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: timeout,
+			TLSClientConfig:  tlsConfig,
+		},
+	}
+}
+
+func (b *WebSocketBackend) Send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		header := http.Header{}
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			header.Set("Authorization", auth)
+		}
+		conn, _, err := b.dialer.DialContext(ctx, b.url.String(), header)
+		if err != nil {
+			return nil, err
+		}
+		b.conn = conn
+	}
+
+	response, err := b.roundTrip(ctx, body)
+	if err != nil {
+		b.conn.Close()
+		b.conn = nil
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return newResponse(req, http.StatusOK, jsonHeader(), response), nil
+}
+
+func (b *WebSocketBackend) roundTrip(ctx context.Context, body []byte) ([]byte, error) {
+	deadline, _ := ctx.Deadline()
+	b.conn.SetWriteDeadline(deadline) //nolint:errcheck
+	b.conn.SetReadDeadline(deadline)  //nolint:errcheck
+	// unblock the read if the request is cancelled before its deadline
+	stop := context.AfterFunc(ctx, func() { b.conn.SetReadDeadline(time.Now()) }) //nolint:errcheck
+	defer stop()
+
+	if err := b.conn.WriteMessage(websocket.TextMessage, body); err != nil {
+		return nil, err
+	}
+	messageType, response, err := b.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return nil, errUnexpectedMessage
+	}
+	return response, nil
+}
+
+// Close closes the connection
+func (b *WebSocketBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
@@ -0,0 +1,338 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errFaultDropped       = errors.New("request dropped by fault injection")
+	errChaosAdminNotLocal = errors.New("chaos admin API must listen on a loopback address unless remote access is allowed")
+)
+
+// Fault is injected into a share of the requests to a builder
+type Fault struct {
+	Builder     string   `json:"builder,omitempty"`      // builder url, all builders if empty
+	Method      string   `json:"method,omitempty"`       // method prefix, all methods if empty
+	Percent     float64  `json:"percent"`                // share of matching requests the fault is injected into
+	Latency     Duration `json:"latency,omitempty"`      // delay before the request is sent
+	Drop        bool     `json:"drop,omitempty"`         // fail the request like a network error without sending it
+	StatusCode  int      `json:"status_code,omitempty"`  // respond with the status code without sending the request
+	CorruptGzip bool     `json:"corrupt_gzip,omitempty"` // replace the response body with corrupted gzip
+	Truncate    bool     `json:"truncate,omitempty"`     // cut the response body in half
+}
+
+// validate checks the fault and normalizes its builder url like the builder urls of the proxy
+func (f *Fault) validate() error {
+	if f.Builder != "" {
+		url, err := ParseURL(f.Builder)
+		if err != nil {
+			return fmt.Errorf("invalid builder %s: %w", f.Builder, err)
+		}
+		f.Builder = url.String()
+	}
+	if f.Percent <= 0 || f.Percent > 100 {
+		return fmt.Errorf("invalid percent %v, expected more than 0 and up to 100", f.Percent)
+	}
+	if f.StatusCode != 0 && (f.StatusCode < 100 || f.StatusCode > 599) {
+		return fmt.Errorf("invalid status code %d", f.StatusCode)
+	}
+	return nil
+}
+
+// ChaosConfig is the fault injection config, read from a file or set with the admin API
+type ChaosConfig struct {
+	Faults []Fault `json:"faults"`
+}
+
+func (c *ChaosConfig) validate() error {
+	for i := range c.Faults {
+		if err := c.Faults[i].validate(); err != nil {
+			return fmt.Errorf("fault %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// LoadChaosConfig reads the fault injection config file
+func LoadChaosConfig(path string) (*ChaosConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config ChaosConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse chaos config %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// CheckChaosAdminAddr returns an error if the admin API would listen on a non-loopback address without
+// allowRemote. The admin API has no authentication, so anyone reaching it can break the builder requests.
+func CheckChaosAdminAddr(addr string, allowRemote bool) error {
+	if allowRemote {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid chaos admin address %s: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%w: %s", errChaosAdminNotLocal, addr)
+	}
+	return nil
+}
+
+// Chaos injects faults into the requests to builders, to check how the proxy handles misbehaving builders.
+// The faults can be changed at runtime with the admin API served by ServeHTTP.
+type Chaos struct {
+	log *logrus.Entry
+
+	mu       sync.RWMutex
+	faults   []Fault
+	builders map[string]bool   // urls of the wrapped builders
+	injected map[string]uint64 // number of injected faults by builder url
+}
+
+// NewChaos creates a fault injector with the faults of the config, which may be nil
+func NewChaos(config *ChaosConfig, log *logrus.Entry) *Chaos {
+	c := &Chaos{log: log, builders: make(map[string]bool), injected: make(map[string]uint64)}
+	if config != nil {
+		c.faults = config.Faults
+	}
+	return c
+}
+
+// SetFaults replaces the injected faults. Faults for builders which are not wrapped are rejected once
+// any builder is wrapped.
+func (c *Chaos) SetFaults(faults []Fault) error {
+	config := ChaosConfig{Faults: faults}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkBuilders(faults); err != nil {
+		return err
+	}
+	c.faults = faults
+	return nil
+}
+
+// validate checks the current faults after the builders are wrapped
+func (c *Chaos) validate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	config := ChaosConfig{Faults: c.faults}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	return c.checkBuilders(c.faults)
+}
+
+// checkBuilders returns an error if a fault is for an unknown builder, c.mu must be held
+func (c *Chaos) checkBuilders(faults []Fault) error {
+	if len(c.builders) == 0 {
+		return nil
+	}
+	for i, fault := range faults {
+		if fault.Builder != "" && !c.builders[fault.Builder] {
+			return fmt.Errorf("fault %d: unknown builder %s", i, fault.Builder)
+		}
+	}
+	return nil
+}
+
+// chaosStatus is the response of the admin API
+type chaosStatus struct {
+	Faults   []Fault           `json:"faults"`
+	Injected map[string]uint64 `json:"injected"`
+}
+
+// ServeHTTP serves the admin API: GET returns the faults and the number of injected faults by builder, PUT
+// replaces the faults with a ChaosConfig and DELETE removes all faults
+func (c *Chaos) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var config ChaosConfig
+		if err := json.NewDecoder(req.Body).Decode(&config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.SetFaults(config.Faults); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.log.WithField("faults", len(config.Faults)).Warn("fault injection config changed")
+	case http.MethodDelete:
+		c.SetFaults(nil) //nolint:errcheck
+		c.log.Warn("fault injection disabled")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.mu.RLock()
+	status := chaosStatus{Faults: c.faults, Injected: make(map[string]uint64, len(c.injected))}
+	for url, count := range c.injected {
+		status.Injected[url] = count
+	}
+	c.mu.RUnlock()
+	if status.Faults == nil {
+		status.Faults = []Fault{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status) //nolint:errcheck
+}
+
+// wrap returns the backend of the builder with fault injection
+func (c *Chaos) wrap(url string, backend Backend) Backend {
+	if parsed, err := ParseURL(url); err == nil {
+		url = parsed.String()
+	}
+	c.mu.Lock()
+	c.builders[url] = true
+	c.mu.Unlock()
+	return &faultBackend{next: backend, url: url, chaos: c}
+}
+
+// pick returns the fault injected into the request, nil if there is none
+func (c *Chaos) pick(url string, req *http.Request) *Fault {
+	c.mu.RLock()
+	faults := c.faults
+	c.mu.RUnlock()
+
+	method := ""
+	for i := range faults {
+		fault := &faults[i]
+		if fault.Builder != "" && fault.Builder != url {
+			continue
+		}
+		if fault.Method != "" {
+			if method == "" {
+				method = requestMethodOf(req)
+			}
+			if !strings.HasPrefix(method, fault.Method) {
+				continue
+			}
+		}
+		if rand.Float64()*100 >= fault.Percent { //nolint:gosec
+			continue
+		}
+
+		c.mu.Lock()
+		c.injected[url]++
+		c.mu.Unlock()
+		return fault
+	}
+	return nil
+}
+
+// requestMethodOf returns the JSON-RPC method of the request to a backend
+func requestMethodOf(req *http.Request) string {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return ""
+	}
+	return requestMethod(body)
+}
+
+// faultBackend injects the faults of the chaos config into the requests of a builder
+type faultBackend struct {
+	next  Backend
+	url   string
+	chaos *Chaos
+}
+
+func (b *faultBackend) Send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	fault := b.chaos.pick(b.url, req)
+	if fault == nil {
+		return b.next.Send(ctx, req)
+	}
+	b.chaos.log.WithFields(logrus.Fields{"url": b.url, "fault": fmt.Sprintf("%+v", *fault)}).Debug("injecting fault into builder request")
+
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency.Duration()):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if fault.Drop {
+		return nil, errFaultDropped
+	}
+	if fault.StatusCode != 0 {
+		return newResponse(req, fault.StatusCode, http.Header{}, nil), nil
+	}
+
+	resp, err := b.next.Send(ctx, req)
+	if err != nil || (!fault.CorruptGzip && !fault.Truncate) {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if fault.CorruptGzip {
+		body, err = corruptGzip(resp.Header.Get("Content-Encoding"), body)
+		if err != nil {
+			return nil, err
+		}
+		resp.Header.Set("Content-Encoding", compression.Gzip)
+	}
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	if fault.Truncate {
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body[:len(body)/2]), errReader{io.ErrUnexpectedEOF}))
+	} else {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return resp, nil
+}
+
+// corruptGzip returns the body compressed with gzip with a flipped byte, so it fails the checksum
+func corruptGzip(encoding string, body []byte) ([]byte, error) {
+	body, err := compression.Decode(encoding, body)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := compression.Encode(compression.Gzip, body)
+	if err != nil {
+		return nil, err
+	}
+	// the trailer has the checksum of the uncompressed body
+	encoded[len(encoded)-8] ^= 0xff
+	return encoded, nil
+}
+
+// errReader fails every read with err
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
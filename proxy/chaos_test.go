@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultBackend(t *testing.T) {
+	builder := mocks.NewServer(t)
+	builder.Response = []byte(mocks.NewPayloadResponseValid)
+	chaos := NewChaos(nil, testLog)
+	backend := chaos.wrap("builder", HandlerBackend{Handler: builder.Handler()})
+
+	t.Run("should pass requests without faults", func(t *testing.T) {
+		resp := sendBackendRequest(t, backend, mocks.NewPayloadRequest)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, mocks.NewPayloadResponseValid, string(body))
+	})
+
+	t.Run("should drop requests and respond with status codes", func(t *testing.T) {
+		require.NoError(t, chaos.SetFaults([]Fault{{Builder: "builder", Method: "engine_forkchoiceUpdated", Percent: 100, Drop: true}, {Percent: 100, StatusCode: http.StatusServiceUnavailable}}))
+		count := builder.GetRequestCount(newPayloadPath)
+
+		req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(mocks.ForkchoiceRequest))
+		require.NoError(t, err)
+		_, err = backend.Send(req.Context(), req)
+		require.ErrorIs(t, err, errFaultDropped)
+
+		resp := sendBackendRequest(t, backend, mocks.NewPayloadRequest)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, count, builder.GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should corrupt and truncate responses", func(t *testing.T) {
+		require.NoError(t, chaos.SetFaults([]Fault{{Percent: 100, CorruptGzip: true}}))
+		resp := sendBackendRequest(t, backend, mocks.NewPayloadRequest)
+		require.Equal(t, compression.Gzip, resp.Header.Get("Content-Encoding"))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_, err = compression.Decode(compression.Gzip, body)
+		require.Error(t, err)
+
+		require.NoError(t, chaos.SetFaults([]Fault{{Percent: 100, Truncate: true}}))
+		resp = sendBackendRequest(t, backend, mocks.NewPayloadRequest)
+		body, err = io.ReadAll(resp.Body)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		require.Equal(t, mocks.NewPayloadResponseValid[:len(mocks.NewPayloadResponseValid)/2], string(body))
+	})
+
+	t.Run("should add latency", func(t *testing.T) {
+		require.NoError(t, chaos.SetFaults([]Fault{{Percent: 100, Latency: Duration(50 * time.Millisecond)}}))
+		start := time.Now()
+		resp := sendBackendRequest(t, backend, mocks.NewPayloadRequest)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	require.Error(t, chaos.SetFaults([]Fault{{Percent: 0}}))
+	require.Error(t, chaos.SetFaults([]Fault{{Percent: 10, StatusCode: 1000}}))
+}
+
+func TestChaos(t *testing.T) {
+	t.Run("should fall back to the other builders if the primary builder fails", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		chaos := NewChaos(&ChaosConfig{Faults: []Fault{{Builder: backend.builders[0].Server.URL, Percent: 100, Drop: true}}}, testLog)
+		for _, entry := range backend.proxyService.builderEntries {
+			entry.Backend = chaos.wrap(entry.URL.String(), entry.Backend)
+		}
+		backend.builders[1].Response = []byte(mocks.NewPayloadResponseSyncing)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, mocks.NewPayloadResponseSyncing, rr.Body.String())
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should match builders without scheme and reject unknown builders", func(t *testing.T) {
+		builders := createMockServers(t, 2)
+		urls := getURLs(t, builders)
+		chaos := NewChaos(&ChaosConfig{Faults: []Fault{{Builder: urls[0].Host, Percent: 100, Drop: true}}}, testLog)
+		backend := &testBackend{builders: builders}
+		service, err := NewProxyService(ProxyServiceOpts{Log: testLog, Builders: urls, BuilderTimeout: time.Second, Chaos: chaos})
+		require.NoError(t, err)
+		backend.proxyService = service
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 0, builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, builders[1].GetRequestCount(newPayloadPath))
+
+		require.Error(t, chaos.SetFaults([]Fault{{Builder: "localhost:1", Percent: 100, Drop: true}}))
+
+		chaos = NewChaos(&ChaosConfig{Faults: []Fault{{Builder: "localhost:1", Percent: 100, Drop: true}}}, testLog)
+		_, err = NewProxyService(ProxyServiceOpts{Log: testLog, Builders: urls, BuilderTimeout: time.Second, Chaos: chaos})
+		require.Error(t, err)
+	})
+
+	t.Run("should change the faults with the admin API", func(t *testing.T) {
+		chaos := NewChaos(nil, testLog)
+		server := httptest.NewServer(chaos)
+		defer server.Close()
+
+		config := `{"faults":[{"builder":"http://localhost:8551","percent":10,"latency":"100ms"}]}`
+		req, err := http.NewRequest(http.MethodPut, server.URL, bytes.NewReader([]byte(config)))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, err = http.Get(server.URL)
+		require.NoError(t, err)
+		var status chaosStatus
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		resp.Body.Close()
+		require.Equal(t, []Fault{{Builder: "http://localhost:8551", Percent: 10, Latency: Duration(100 * time.Millisecond)}}, status.Faults)
+
+		req, err = http.NewRequest(http.MethodPut, server.URL, bytes.NewReader([]byte(`{"faults":[{"percent":200}]}`)))
+		require.NoError(t, err)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		req, err = http.NewRequest(http.MethodDelete, server.URL, nil)
+		require.NoError(t, err)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		resp.Body.Close()
+		require.Empty(t, status.Faults)
+	})
+}
+
+func TestCheckChaosAdminAddr(t *testing.T) {
+	for _, addr := range []string{"localhost:25591", "127.0.0.1:25591", "[::1]:25591"} {
+		require.NoError(t, CheckChaosAdminAddr(addr, false), addr)
+	}
+	for _, addr := range []string{":25591", "0.0.0.0:25591", "10.0.0.1:25591", "example.com:25591"} {
+		require.ErrorIs(t, CheckChaosAdminAddr(addr, false), errChaosAdminNotLocal, addr)
+		require.NoError(t, CheckChaosAdminAddr(addr, true), addr)
+	}
+	require.Error(t, CheckChaosAdminAddr("localhost", false))
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoding(t *testing.T) {
+	encodedRequest := func(t *testing.T, encoding string, acceptEncoding string) *http.Request {
+		body, err := compression.Encode(encoding, []byte(mocks.NewPayloadRequest))
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", encoding)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		req.RemoteAddr = from
+		return req
+	}
+
+	t.Run("should decompress gzip and zstd request bodies", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		for _, encoding := range []string{compression.Gzip, compression.Zstd} {
+			rr := httptest.NewRecorder()
+			backend.proxyService.ServeHTTP(rr, encodedRequest(t, encoding, ""))
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			require.Empty(t, backend.builders[0].GetLastHeader().Get("Content-Encoding"))
+		}
+		require.Equal(t, 2, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should reject unsupported request encodings", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		req := encodedRequest(t, "", "")
+		req.Header.Set("Content-Encoding", "br")
+		rr := httptest.NewRecorder()
+		backend.proxyService.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should compress requests and negotiate responses per builder", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].RequestEncoding = compression.Zstd
+		backend.proxyService.builderEntries[0].AcceptEncoding = compression.Zstd
+		backend.builders[0].ResponseEncoding = compression.Zstd
+
+		rr := httptest.NewRecorder()
+		backend.proxyService.ServeHTTP(rr, encodedRequest(t, compression.Gzip, compression.Gzip))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		header := backend.builders[0].GetLastHeader()
+		require.Equal(t, compression.Zstd, header.Get("Content-Encoding"))
+		require.Equal(t, compression.Zstd, header.Get("Accept-Encoding"))
+
+		// the beacon node doesn't accept zstd and gets the uncompressed response
+		require.Empty(t, rr.Header().Get("Content-Encoding"))
+		require.Equal(t, mocks.NewPayloadResponseValid, rr.Body.String())
+	})
+
+	t.Run("should pass compressed responses accepted by the beacon node", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.builders[0].ResponseEncoding = compression.Gzip
+
+		rr := httptest.NewRecorder()
+		backend.proxyService.ServeHTTP(rr, encodedRequest(t, "", compression.Gzip))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, compression.Gzip, rr.Header().Get("Content-Encoding"))
+
+		body, err := compression.Decode(compression.Gzip, rr.Body.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, mocks.NewPayloadResponseValid, string(body))
+	})
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flashbots/sync-proxy/compression"
+)
+
+// Duration is a time.Duration which is read from a string like "500ms" in the config file
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Config is the content of the optional config file
+type Config struct {
+	Builders []BuilderConfig `json:"builders"`
+	Routes   []RouteConfig   `json:"routes,omitempty"`
+}
+
+// BuilderConfig contains the settings for a single builder, unset values fall back to the flag defaults
+type BuilderConfig struct {
+	URL   string       `json:"url"`
+	Retry *RetryConfig `json:"retry,omitempty"`
+
+	// Group is the name of the builder's group, e.g. its EL client, the first builder of a group is its primary
+	// unless the group is made only of shadow builders
+	Group string `json:"group,omitempty"`
+
+	// Async builders get requests through an ordered background queue and are never used for the response
+	Async bool `json:"async,omitempty"`
+	// Shadow builders get every request and their responses are compared with the response sent to the beacon
+	// node, but they are never used for it, even if all other builders failed
+	Shadow bool `json:"shadow,omitempty"`
+
+	// RequestEncoding compresses request bodies sent to the builder (gzip or zstd)
+	RequestEncoding string `json:"request_encoding,omitempty"`
+	// AcceptEncoding replaces the Accept-Encoding header of the beacon node in requests to the builder
+	AcceptEncoding string `json:"accept_encoding,omitempty"`
+
+	// StripPayloadAttributes sends forkchoiceUpdated with null payload attributes, so only the other builders
+	// build blocks and the builder responds with a null payloadId. Not allowed for the first builder of a group.
+	StripPayloadAttributes bool `json:"strip_payload_attributes,omitempty"`
+
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// Timeout replaces -request-timeout and -method-timeouts for the builder, MethodTimeouts are added to them
+	Timeout        Duration            `json:"timeout,omitempty"`
+	MethodTimeouts map[string]Duration `json:"method_timeouts,omitempty"`
+
+	// MaxResponseSize replaces -max-response-size for the builder, in bytes
+	MaxResponseSize int64 `json:"max_response_size,omitempty"`
+}
+
+// groupName returns the builder's group, the default group if the builder has no config or no group
+func (c *BuilderConfig) groupName() string {
+	if c == nil || c.Group == "" {
+		return DefaultGroup
+	}
+	return c.Group
+}
+
+// timeouts returns the builder's timeout and method timeouts, the more specific setting wins: the builder's
+// method timeouts, the builder's timeout, then the default method timeouts and the default timeout
+func (c *BuilderConfig) timeouts(timeout time.Duration, methodTimeouts map[string]time.Duration) (time.Duration, map[string]time.Duration) {
+	if c.Timeout > 0 {
+		timeout, methodTimeouts = c.Timeout.Duration(), nil
+	}
+	if len(c.MethodTimeouts) == 0 {
+		return timeout, methodTimeouts
+	}
+
+	merged := make(map[string]time.Duration, len(methodTimeouts)+len(c.MethodTimeouts))
+	for method, methodTimeout := range methodTimeouts {
+		merged[method] = methodTimeout
+	}
+	for method, methodTimeout := range c.MethodTimeouts {
+		merged[method] = methodTimeout.Duration()
+	}
+	return timeout, merged
+}
+
+// LoadConfig reads and validates the config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode config file %s: %w", path, err)
+	}
+
+	for i, builder := range config.Builders {
+		if builder.URL == "" {
+			return nil, fmt.Errorf("builder %d in config file has no url", i)
+		}
+		if builder.Async && builder.Shadow {
+			return nil, fmt.Errorf("builder %s in config file can not be both async and shadow", builder.URL)
+		}
+		if !compression.IsSupported(builder.RequestEncoding) {
+			return nil, fmt.Errorf("%w for builder %s: %s", compression.ErrUnsupported, builder.URL, builder.RequestEncoding)
+		}
+	}
+	for i := range config.Routes {
+		if err := config.Routes[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &config, nil
+}
+
+// ParseURL parses a builder or proxy url, http:// is added if there is no scheme
+func ParseURL(rawURL string) (*url.URL, error) {
+	// Add protocol scheme prefix if it does not exist.
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+
+	// Parse the provided URL.
+	return url.ParseRequestURI(rawURL)
+}
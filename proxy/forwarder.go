@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultProxyQueueSize = 64
+	defaultProxyWait      = 50 * time.Millisecond
+)
+
+// proxyJob is a request waiting to be forwarded to another proxy
+type proxyJob struct {
+	req  *http.Request
+	done func()
+}
+
+// proxyForwarder forwards requests to another proxy through a bounded queue served by a fixed number of workers
+type proxyForwarder struct {
+	entry  *ProxyEntry
+	tracer trace.Tracer
+	log    *logrus.Entry
+
+	mu     sync.RWMutex // guards sending to jobs against close
+	closed bool
+	jobs   chan *proxyJob
+	wg     sync.WaitGroup
+
+	numSuccess   atomic.Uint64
+	numFailure   atomic.Uint64
+	numDropped   atomic.Uint64
+	totalLatency atomic.Int64
+}
+
+func newProxyForwarder(entry *ProxyEntry, numWorkers, queueSize int, tracer trace.Tracer, log *logrus.Entry) *proxyForwarder {
+	f := &proxyForwarder{
+		entry:  entry,
+		tracer: tracer,
+		log:    log.WithField("url", entry.URL.String()),
+		jobs:   make(chan *proxyJob, queueSize),
+	}
+
+	for i := 0; i < max(numWorkers, 1); i++ {
+		f.wg.Add(1)
+		go f.work()
+	}
+	return f
+}
+
+// enqueue queues the request for forwarding. If the queue is full it waits for space until ctx is done, then
+// the request is dropped, so a slow proxy only delays the beacon node's requests briefly. done is called in any case.
+func (f *proxyForwarder) enqueue(ctx context.Context, req *http.Request, done func()) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		f.drop(done)
+		return
+	}
+
+	job := &proxyJob{req: req, done: done}
+	select {
+	case f.jobs <- job:
+		return
+	default:
+	}
+	select {
+	case f.jobs <- job:
+	case <-ctx.Done():
+		f.drop(done)
+	}
+}
+
+func (f *proxyForwarder) drop(done func()) {
+	f.numDropped.Add(1)
+	f.log.Error("proxy queue is full, dropping request")
+	done()
+}
+
+func (f *proxyForwarder) work() {
+	defer f.wg.Done()
+	for job := range f.jobs {
+		f.forward(job.req)
+		job.done()
+	}
+}
+
+func (f *proxyForwarder) forward(req *http.Request) {
+	ctx, span := f.tracer.Start(req.Context(), "proxy forward", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("proxy.url", f.entry.URL.String())))
+	injectTraceContext(ctx, req.Header)
+
+	if f.entry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.entry.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	resp, err := f.entry.Backend.Send(ctx, req)
+	if err == nil {
+		// drain the body so the connection can be reused
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+		resp.Body.Close()
+		endSpan(span, resp.StatusCode, nil)
+	} else {
+		endSpan(span, 0, err)
+	}
+	f.totalLatency.Add(int64(time.Since(start)))
+
+	if err != nil {
+		f.numFailure.Add(1)
+		f.log.WithError(err).Error("error sending request to proxy")
+		return
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		f.numFailure.Add(1)
+		f.log.WithField("statusCode", resp.StatusCode).Error("error response from proxy")
+		return
+	}
+	f.numSuccess.Add(1)
+}
+
+// close stops accepting requests and waits until the queued requests are forwarded
+func (f *proxyForwarder) close() {
+	f.mu.Lock()
+	f.closed = true
+	close(f.jobs)
+	f.mu.Unlock()
+
+	f.wg.Wait()
+}
+
+func (f *proxyForwarder) stats() ProxyStats {
+	stats := ProxyStats{
+		URL:         statsURL(f.entry.URL),
+		Success:     f.numSuccess.Load(),
+		Failure:     f.numFailure.Load(),
+		Dropped:     f.numDropped.Load(),
+		QueueLength: len(f.jobs),
+	}
+	if completed := stats.Success + stats.Failure; completed > 0 {
+		stats.AvgLatencyMs = float64(f.totalLatency.Load()) / float64(completed) / float64(time.Millisecond)
+	}
+	return stats
+}
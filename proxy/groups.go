@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultGroup is the group of builders without a group in their config
+const DefaultGroup = "default"
+
+var errUnknownGroup = errors.New("preferred group has no builders")
+
+// builderGroup is a named set of builders, e.g. the builders running the same EL client. Each group has its own
+// primary builder, the first builder of the group, whose responses the other builders of the group are compared with.
+type builderGroup struct {
+	name    string
+	primary *ProxyEntry
+
+	numDivergences      atomic.Uint64
+	numGroupDivergences atomic.Uint64
+}
+
+// GroupStats contains the divergence statistics of a builder group
+type GroupStats struct {
+	Name             string `json:"name"`
+	Primary          string `json:"primary"`
+	Divergences      uint64 `json:"divergences"`       // responses of the group's builders differing from the group's primary
+	GroupDivergences uint64 `json:"group_divergences"` // responses of the group differing from the preferred group
+}
+
+func (g *builderGroup) stats() GroupStats {
+	return GroupStats{
+		Name:             g.name,
+		Primary:          statsURL(g.primary.URL),
+		Divergences:      g.numDivergences.Load(),
+		GroupDivergences: g.numGroupDivergences.Load(),
+	}
+}
+
+// groupBuilders returns the groups of the builders in the order they appear in, the preferred group first, and
+// moves the builders of the preferred group to the front so its primary becomes the primary of all builders
+func groupBuilders(entries []*ProxyEntry, preferred string) ([]*builderGroup, []*ProxyEntry, error) {
+	if preferred == "" {
+		preferred = entries[0].Group
+	}
+
+	var groups []*builderGroup
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.Group] {
+			continue
+		}
+		seen[entry.Group] = true
+		group := &builderGroup{name: entry.Group, primary: entry}
+		if entry.Group == preferred {
+			groups = append([]*builderGroup{group}, groups...)
+		} else {
+			groups = append(groups, group)
+		}
+	}
+	if !seen[preferred] {
+		return nil, nil, errUnknownGroup
+	}
+
+	sorted := make([]*ProxyEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Group == preferred {
+			sorted = append(sorted, entry)
+		}
+	}
+	for _, entry := range entries {
+		if entry.Group != preferred {
+			sorted = append(sorted, entry)
+		}
+	}
+	return groups, sorted, nil
+}
+
+// preferredGroup returns the group the response to the beacon node is taken from
+func (p *ProxyService) preferredGroup() string {
+	return p.groups[0].name
+}
+
+// logResponseDifferences compares the payload status of the builders of each group with the group's primary, and
+// the status of each group with the preferred group. The primary's response is replaced by another response of
+// the group if the primary failed.
+func (p *ProxyService) logResponseDifferences(method string, responses []BuilderResponse) {
+	groupResponses := make(map[string]BuilderResponse, len(p.groups))
+	for _, group := range p.groups {
+		for _, response := range responses {
+			if response.Group != group.name {
+				continue
+			}
+			if _, ok := groupResponses[group.name]; !ok || response.URL == group.primary.URL {
+				groupResponses[group.name] = response
+			}
+		}
+	}
+
+	for _, group := range p.groups {
+		expected, ok := groupResponses[group.name]
+		if !ok || expected.Status == "" {
+			continue
+		}
+		for _, response := range responses {
+			if response.Group != group.name || response.URL == expected.URL || response.Status == expected.Status {
+				continue
+			}
+			group.numDivergences.Add(1)
+			p.log.WithFields(logrus.Fields{
+				"method":          method,
+				"group":           group.name,
+				"primaryStatus":   expected.Status,
+				"secondaryStatus": response.Status,
+				"primaryUrl":      expected.URL.String(),
+				"secondaryUrl":    response.URL.String(),
+			}).Info("found difference in EL responses")
+		}
+	}
+
+	preferred, ok := groupResponses[p.preferredGroup()]
+	if !ok || preferred.Status == "" {
+		return
+	}
+	for _, group := range p.groups[1:] {
+		response, ok := groupResponses[group.name]
+		if !ok || response.Status == preferred.Status {
+			continue
+		}
+		group.numGroupDivergences.Add(1)
+		p.log.WithFields(logrus.Fields{
+			"method":          method,
+			"preferredGroup":  preferred.Group,
+			"group":           group.name,
+			"preferredStatus": preferred.Status,
+			"groupStatus":     response.Status,
+			"preferredUrl":    preferred.URL.String(),
+			"groupUrl":        response.URL.String(),
+		}).Info("found difference between builder groups")
+	}
+}
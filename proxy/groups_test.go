@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// withGroups puts the builders into the given groups and sets the preferred group
+func withGroups(preferredGroup string, groups ...string) func(opts *ProxyServiceOpts) {
+	return func(opts *ProxyServiceOpts) {
+		opts.BuilderConfigs = make(map[string]*BuilderConfig, len(groups))
+		for i, group := range groups {
+			opts.BuilderConfigs[opts.Builders[i].String()] = &BuilderConfig{Group: group}
+		}
+		opts.PreferredGroup = preferredGroup
+	}
+}
+
+func TestBuilderGroups(t *testing.T) {
+	t.Run("should respond with the primary of the preferred group and report differences", func(t *testing.T) {
+		backend := newTestBackend(t, 4, 0, time.Second, time.Second, withGroups("reth", "geth", "geth", "reth", "reth"))
+		backend.builders[2].Response = []byte(mocks.NewPayloadResponseSyncing)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, mocks.NewPayloadResponseSyncing, rr.Body.String())
+
+		require.Equal(t, []GroupStats{
+			{Name: "reth", Primary: backend.builders[2].Server.URL, Divergences: 1},
+			{Name: "geth", Primary: backend.builders[0].Server.URL, GroupDivergences: 1},
+		}, backend.proxyService.Stats().Groups)
+	})
+
+	t.Run("should fall back to a builder of the preferred group", func(t *testing.T) {
+		backend := newTestBackend(t, 3, 0, time.Second, time.Second, withGroups("reth", "geth", "reth", "reth"))
+		backend.builders[1].Server.Close()
+		backend.builders[2].Response = []byte(mocks.NewPayloadResponseSyncing)
+		backend.builders[2].ResponseDelay = 50 * time.Millisecond
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, mocks.NewPayloadResponseSyncing, rr.Body.String())
+		require.Equal(t, uint64(1), backend.proxyService.Stats().Groups[1].GroupDivergences)
+	})
+
+	t.Run("builders without group are in the default group", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second, withGroups("", "", "nethermind"))
+		require.Equal(t, DefaultGroup, backend.proxyService.preferredGroup())
+		require.Len(t, backend.proxyService.Stats().Groups, 2)
+	})
+
+	t.Run("preferred group must have builders", func(t *testing.T) {
+		opts := ProxyServiceOpts{Log: testLog, Builders: getURLs(t, createMockServers(t, 2)), BuilderTimeout: time.Second}
+		withGroups("erigon", "geth", "reth")(&opts)
+		_, err := NewProxyService(opts)
+		require.ErrorIs(t, err, errUnknownGroup)
+	})
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+const unixScheme = "unix://"
+
+// listenAll opens a listener for each address in a comma-separated list, e.g. 127.0.0.1:25590,[::1]:25590
+// to listen on both IPv4 and IPv6 loopback. An address without host like :25590 is dual-stack already.
+func listenAll(addrs string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+
+		listener, err := listen(addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listen opens a TCP listener, or a unix domain socket listener for addresses like unix:///path/to/proxy.sock
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixScheme); ok {
+		// remove a stale socket left behind by a previous run
+		if info, err := os.Stat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
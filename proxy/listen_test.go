@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sync-proxy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("should send requests to builder on unix socket", func(t *testing.T) {
+		socketPath := filepath.Join(dir, "engine.sock")
+		builder := mocks.NewServer(t)
+		builder.Response = []byte(mocks.NewPayloadResponseValid)
+		builder.Server.Close()
+
+		listener, err := listen(unixScheme + socketPath)
+		require.NoError(t, err)
+		builder.Server = httptest.NewUnstartedServer(builder.Handler())
+		builder.Server.Listener = listener
+		builder.Server.Start()
+		defer builder.Server.Close()
+
+		builderURL, err := ParseURL(unixScheme + socketPath)
+		require.NoError(t, err)
+		service, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			Builders:       []*url.URL{builderURL},
+			BuilderTimeout: time.Second,
+		})
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		req.RemoteAddr = from
+		rr := httptest.NewRecorder()
+		service.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, mocks.NewPayloadResponseValid, rr.Body.String())
+		require.Equal(t, 1, builder.GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should listen on unix socket", func(t *testing.T) {
+		socketPath := filepath.Join(dir, "proxy.sock")
+		// a stale socket file from a previous run is replaced
+		stale, err := net.Listen("unix", socketPath)
+		require.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		builders := createMockServers(t, 1)
+		service, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			ListenAddr:     unixScheme + socketPath,
+			Builders:       getURLs(t, builders),
+			BuilderTimeout: time.Second,
+		})
+		require.NoError(t, err)
+		go service.StartHTTPServer() //nolint:errcheck
+		t.Cleanup(service.Close)
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		}}
+		require.Eventually(t, func() bool {
+			resp, err := client.Post("http://localhost/", "application/json", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, 1, builders[0].GetRequestCount(newPayloadPath))
+	})
+}
+
+func TestDualStack(t *testing.T) {
+	if ln, err := net.Listen("tcp", "[::1]:0"); err != nil {
+		t.Skip("IPv6 loopback is not available:", err)
+	} else {
+		ln.Close()
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	builders := createMockServers(t, 1)
+	service, err := NewProxyService(ProxyServiceOpts{
+		Log:            testLog,
+		ListenAddr:     fmt.Sprintf("127.0.0.1:%d,[::1]:%d", port, port),
+		Builders:       getURLs(t, builders),
+		BuilderTimeout: time.Second,
+	})
+	require.NoError(t, err)
+	go service.StartHTTPServer() //nolint:errcheck
+	t.Cleanup(service.Close)
+
+	for _, host := range []string{"127.0.0.1", "[::1]"} {
+		require.Eventually(t, func() bool {
+			resp, err := http.Post(fmt.Sprintf("http://%s:%d/", host, port), "application/json", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK
+		}, time.Second, 10*time.Millisecond, host)
+	}
+	require.Equal(t, 2, builders[0].GetRequestCount(newPayloadPath))
+}
+
+func TestCloseServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	service, err := NewProxyService(ProxyServiceOpts{
+		Log:            testLog,
+		ListenAddr:     addr,
+		Builders:       getURLs(t, createMockServers(t, 1)),
+		BuilderTimeout: time.Second,
+	})
+	require.NoError(t, err)
+	errC := make(chan error, 1)
+	go func() { errC <- service.StartHTTPServer() }()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	service.Close()
+	require.NoError(t, <-errC)
+	_, err = http.Get("http://" + addr + "/")
+	require.Error(t, err)
+}
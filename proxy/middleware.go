@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/flashbots/sync-proxy/beacon"
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/engineapi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Request is a beacon node request passing through the middleware chain
+type Request struct {
+	HTTP       *http.Request            // the beacon node request, its body is already read into Body
+	Body       []byte                   // uncompressed request body, sent to the builders and proxies
+	RemoteHost string                   // address of the beacon node, set by the read body middleware if empty
+	JSON       engineapi.JSONRPCRequest // parsed request, set by the parse middleware
+	WebSocket  bool                     // received as WebSocket message, the response is sent as one message
+}
+
+// Handler handles a beacon node request
+type Handler func(w http.ResponseWriter, r *Request)
+
+// Middleware wraps the handling of a beacon node request. It can run code before and after calling next,
+// modify the request, or respond itself without calling next.
+type Middleware func(next Handler) Handler
+
+// chain builds the handler of HTTP requests from beacon nodes. The request body is read and parsed, filtered,
+// sent to the builders and then to the proxies. Custom middlewares run before parsing with the raw body or
+// after filtering with the parsed request.
+func (p *ProxyService) chain(preParse, postParse []Middleware) Handler {
+	var middlewares []Middleware
+	middlewares = append(middlewares, p.traceRequest, p.readBody, p.detectLoop)
+	middlewares = append(middlewares, preParse...)
+	middlewares = append(middlewares, p.parseRequest, p.filterRequest)
+	middlewares = append(middlewares, postParse...)
+	middlewares = append(middlewares, p.forwardToProxies)
+
+	handler := p.forwardToBuilders
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// traceRequest starts the span of the request, continuing the trace of the beacon node or another proxy
+func (p *ProxyService) traceRequest(next Handler) Handler {
+	return func(w http.ResponseWriter, r *Request) {
+		ctx, span := p.tracer.Start(propagator.Extract(r.HTTP.Context(), propagation.HeaderCarrier(r.HTTP.Header)), "beacon request",
+			trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attribute.String("sync_proxy.instance_id", p.instanceID)))
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		defer func() { endSpan(span, recorder.statusCode, nil) }()
+
+		r.HTTP = r.HTTP.WithContext(ctx)
+		next(recorder, r)
+	}
+}
+
+// readBody reads and decompresses the request body
+func (p *ProxyService) readBody(next Handler) Handler {
+	return func(w http.ResponseWriter, r *Request) {
+		bodyBytes, err := io.ReadAll(r.HTTP.Body)
+		defer r.HTTP.Body.Close()
+		if err != nil {
+			p.log.WithError(err).Error("failed to read request body")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// forward plain request bodies, the encoding to each builder is set per builder
+		encoding := r.HTTP.Header.Get("Content-Encoding")
+		bodyBytes, err = compression.Decode(encoding, bodyBytes)
+		if errors.Is(err, compression.ErrUnsupported) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			p.log.WithError(err).WithField("encoding", encoding).Error("failed to decode request body")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.HTTP.Header.Del("Content-Encoding")
+
+		r.Body = bodyBytes
+		if r.RemoteHost == "" {
+			r.RemoteHost = beacon.RemoteHost(r.HTTP, p.trustedProxies)
+		}
+		trace.SpanFromContext(r.HTTP.Context()).SetAttributes(attribute.String("beacon.remote_host", r.RemoteHost))
+		next(w, r)
+	}
+}
+
+// detectLoop rejects requests which already passed through this proxy
+func (p *ProxyService) detectLoop(next Handler) Handler {
+	return func(w http.ResponseWriter, r *Request) {
+		if hasVia(r.HTTP.Header, p.instanceID) {
+			p.log.WithField("via", r.HTTP.Header.Values(viaHeader)).Warn("request already passed through this proxy, proxies are configured in a loop")
+			http.Error(w, errLoopDetected.Error(), http.StatusLoopDetected)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// parseRequest parses the JSON-RPC request and updates the beacon node the builders are synced to
+func (p *ProxyService) parseRequest(next Handler) Handler {
+	return func(w http.ResponseWriter, r *Request) {
+		requestJSON, err := p.checkBeaconRequest(r.Body, r.RemoteHost)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		trace.SpanFromContext(r.HTTP.Context()).SetAttributes(requestAttributes(requestJSON)...)
+
+		r.JSON = requestJSON
+		next(w, r)
+	}
+}
+
+// filterRequest drops requests of beacon nodes the builders aren't synced to and cancelled requests
+func (p *ProxyService) filterRequest(next Handler) Handler {
+	return func(w http.ResponseWriter, r *Request) {
+		if p.shouldFilterRequest(r.RemoteHost, r.JSON.Method) {
+			p.log.WithField("remoteHost", r.RemoteHost).Debug("request filtered from beacon node proxy is not synced to")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		// return if request is cancelled or timed out
+		err := r.HTTP.Context().Err()
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// forwardToProxies forwards the request to the other proxies after it was sent to the builders, also if the
+// response to the beacon node was aborted
+func (p *ProxyService) forwardToProxies(next Handler) Handler {
+	return func(w http.ResponseWriter, r *Request) {
+		defer p.callProxies(r.HTTP, r.Body)
+		next(w, r)
+	}
+}
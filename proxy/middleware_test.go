@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewares(t *testing.T) {
+	t.Run("should run custom middlewares in order around the builder fan-out", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		var calls []string
+		record := func(name string) Middleware {
+			return func(next Handler) Handler {
+				return func(w http.ResponseWriter, r *Request) {
+					calls = append(calls, name+" "+r.JSON.Method)
+					next(w, r)
+					calls = append(calls, "after "+name)
+				}
+			}
+		}
+		backend.proxyService.handler = backend.proxyService.chain([]Middleware{record("pre")}, []Middleware{record("post")})
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, []string{"pre ", "post " + newPayloadPath, "after post", "after pre"}, calls)
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should respond without the builders if a middleware doesn't call next", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		deny := func(next Handler) Handler {
+			return func(w http.ResponseWriter, r *Request) {
+				if r.JSON.Method == newPayloadPath {
+					w.WriteHeader(http.StatusForbidden)
+					w.Write(engineapi.NewJSONRPCError(r.JSON.ID, engineapi.CodeServerError, "denied")) //nolint:errcheck
+					return
+				}
+				next(w, r)
+			}
+		}
+		backend.proxyService.handler = backend.proxyService.chain(nil, []Middleware{deny})
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+
+		rr = backend.request(t, []byte(mocks.ForkchoiceRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(forkchoicePath))
+	})
+
+	t.Run("should send the body modified by a middleware to the builders", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		rewrite := func(next Handler) Handler {
+			return func(w http.ResponseWriter, r *Request) {
+				r.Body = bytes.Replace(r.Body, []byte(newPayloadPath), []byte("engine_newPayloadV2"), 1)
+				next(w, r)
+			}
+		}
+		backend.proxyService.handler = backend.proxyService.chain([]Middleware{rewrite}, nil)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, backend.builders[0].GetRequestCount("engine_newPayloadV2"))
+	})
+}
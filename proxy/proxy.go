@@ -0,0 +1,797 @@
+// Package proxy implements the sync proxy: requests from beacon nodes are sent to multiple builders (execution
+// clients) and other sync proxies, and the response of the primary builder is returned to the beacon node.
+//
+// A ProxyService is created with NewProxyService and served with StartHTTPServer, or mounted into another
+// server with ServeHTTP.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/flashbots/sync-proxy/beacon"
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var (
+	errServerAlreadyRunning        = errors.New("server already running")
+	errNoBuilders                  = errors.New("no builders specified")
+	errNoSuccessfulBuilderResponse = errors.New("no successful builder response")
+	errAsyncPrimaryBuilder         = errors.New("first builder of a group can not be async")
+	errShadowPrimaryBuilder        = errors.New("first builder of a group can not be a shadow")
+	errStripPrimaryBuilder         = errors.New("first builder of a group can not strip payload attributes")
+	errInvalidClientCancel         = errors.New("invalid client cancel mode, expected off, primary or all")
+	errLoopDetected                = errors.New("request already passed through this proxy")
+	errAccessDenied                = errors.New("access denied")
+	errRateLimited                 = errors.New("rate limit exceeded")
+	errRequestFiltered             = errors.New("request filtered, beacon node is not the one the proxy is synced to")
+
+	// viaHeader contains the instance ids of the proxies a forwarded request passed through
+	viaHeader = "X-Sync-Proxy-Via"
+)
+
+// Client cancel modes, which builder requests are cancelled when the beacon node cancels its request
+const (
+	ClientCancelOff     = "off"     // no builder requests, they only end with their timeout
+	ClientCancelPrimary = "primary" // the request to the primary builder, the other builders still get the request
+	ClientCancelAll     = "all"     // all builder requests
+)
+
+// shutdownTimeout is how long pending requests can take when the HTTP server is stopped
+const shutdownTimeout = 5 * time.Second
+
+type BuilderResponse struct {
+	Header     http.Header
+	Body       []byte // nil if the body was streamed to the beacon node or discarded
+	URL        *url.URL
+	StatusCode int
+	Status     string // payload status of newPayload and forkchoiceUpdated responses
+	Group      string // group of the builder
+	Streamed   bool   // the response was already streamed to the beacon node
+
+	streamErr error // streaming the body to the beacon node failed after the headers were sent
+}
+
+// ProxyEntry is an entry consisting of a URL and the backend requests to it are sent with
+type ProxyEntry struct {
+	URL             *url.URL
+	Backend         Backend
+	Timeout         time.Duration
+	MethodTimeouts  map[string]time.Duration // timeouts by method prefix, Timeout for other methods
+	MaxResponseSize int64                    // max size of a response body in bytes, 0 for no limit
+	Retry           RetryConfig
+	RequestEncoding string
+	AcceptEncoding  string
+	Shadow          bool   // responses are only compared, never sent to the beacon node
+	Group           string // builder group, DefaultGroup if not set in the builder's config
+	// forkchoiceUpdated requests are sent with null payload attributes, so the builder doesn't build blocks
+	StripPayloadAttributes bool
+}
+
+// ProxyServiceOpts contains options for the ProxyService
+type ProxyServiceOpts struct {
+	ListenAddr      string
+	Builders        []*url.URL
+	BuilderTimeout  time.Duration
+	MethodTimeouts  map[string]time.Duration  // builder timeouts by method prefix, e.g. engine_newPayload
+	ClientCancel    string                    // client cancel mode: off (default), primary or all
+	MaxResponseSize int64                     // max size of a builder response body in bytes, 0 for no limit
+	BuilderConfigs  map[string]*BuilderConfig // optional per-builder settings, keyed by builder url
+	PreferredGroup  string                    // builder group the response is taken from, the first builder's group if empty
+	Routes          []RouteConfig             // optional routing of methods to some of the builders
+	Backends        map[string]Backend        // optional backends replacing the one of the url's scheme, keyed by builder url
+	Retry           RetryConfig               // default retry policy for builders
+	QueueSize       int                       // max number of requests queued for an async builder
+	QueueDir        string                    // optional directory for the write-ahead logs of async builder queues
+	Proxies         []*url.URL
+	ProxyTimeout    time.Duration
+	ProxyWorkers    int           // number of concurrent requests per proxy
+	ProxyQueueSize  int           // max number of requests waiting to be forwarded per proxy, 64 if not set
+	ProxyWait       time.Duration // max time a request waits for space in the proxy queues, shared by all proxies, 50ms if not set
+	TLSCertFile     string        // serve the listener with TLS if set
+	TLSKeyFile      string
+	TLSClientCAFile string               // require client certificates signed by this CA bundle if set
+	JWTSecret       []byte               // signs fresh JWTs for builder requests from WebSocket connections if set
+	InstanceID      string               // identifies this proxy in the via header of forwarded requests, random if empty
+	BeaconACL       ACL                  // sources allowed to send requests as beacon nodes
+	ProxyACL        ACL                  // sources allowed to forward requests as other proxies
+	TrustedProxies  beacon.IPList        // proxies in front of this proxy whose X-Forwarded-For and X-Real-IP headers are trusted
+	RateLimit       float64              // max requests per second per source, 0 for no limit
+	RateBurst       int                  // max burst of requests per source
+	MaxHops         int                  // requests which passed through this many proxies are not forwarded to other proxies, 0 for no limit
+	TracerProvider  trace.TracerProvider // creates the spans of requests, no tracing if nil
+	Chaos           *Chaos               // injects faults into builder requests if set, for testing only
+	// custom middlewares of HTTP requests, run before the request is parsed or after it is parsed and filtered
+	PreParseMiddlewares []Middleware
+	Middlewares         []Middleware
+	Log                 *logrus.Entry
+}
+
+// ProxyService is a service that proxies requests from beacon node to builders
+type ProxyService struct {
+	listenAddr      string
+	tlsConfig       *tls.Config
+	srvMu           sync.Mutex // guards srv, which is set once the server is started
+	srv             *http.Server
+	builderEntries  []*ProxyEntry
+	builderQueues   []*builderQueue
+	shadowBuilders  []*shadowBuilder
+	groups          []*builderGroup // the preferred group first
+	routes          []*route
+	shadowMu        sync.Mutex // guards adding to shadowWG against Close
+	shadowClosed    bool
+	shadowWG        sync.WaitGroup // pending requests to shadow builders
+	proxyForwarders []*proxyForwarder
+	proxyWait       time.Duration
+	beacons         *beacon.Tracker
+	instanceID      string
+	maxHops         int
+	clientCancel    string
+	jwtSecret       []byte
+	beaconACL       ACL
+	proxyACL        ACL
+	trustedProxies  beacon.IPList
+	rateLimiter     *rateLimiter
+	tracer          trace.Tracer
+	handler         Handler
+
+	numWebSocketConns    atomic.Uint64
+	numRejectedACL       atomic.Uint64
+	numRejectedRateLimit atomic.Uint64
+
+	log *logrus.Entry
+}
+
+// NewProxyService creates a new ProxyService
+func NewProxyService(opts ProxyServiceOpts) (*ProxyService, error) {
+	if len(opts.Builders) == 0 {
+		return nil, errNoBuilders
+	}
+	if opts.Log == nil {
+		opts.Log = logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	clientCancel := opts.ClientCancel
+	switch clientCancel {
+	case "":
+		clientCancel = ClientCancelOff
+	case ClientCancelOff, ClientCancelPrimary, ClientCancelAll:
+	default:
+		return nil, fmt.Errorf("%w: %s", errInvalidClientCancel, clientCancel)
+	}
+
+	var builderEntries []*ProxyEntry
+	var builderQueues []*builderQueue
+	var shadowBuilders []*shadowBuilder
+	var tlsConfig *tls.Config
+	if opts.TLSCertFile != "" || opts.TLSKeyFile != "" {
+		var err error
+		tlsConfig, err = buildServerTLSConfig(opts.TLSCertFile, opts.TLSKeyFile, opts.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// groups made only of shadow builders have no primary, they are only compared with the response to the beacon node
+	shadowGroups := make(map[string]bool)
+	for _, builder := range opts.Builders {
+		config, ok := opts.BuilderConfigs[builder.String()]
+		group := config.groupName()
+		if _, seen := shadowGroups[group]; !seen {
+			shadowGroups[group] = true
+		}
+		shadowGroups[group] = shadowGroups[group] && ok && config.Shadow
+	}
+
+	groupNames := make(map[string]bool)
+	for _, builder := range opts.Builders {
+		config, ok := opts.BuilderConfigs[builder.String()]
+		group := config.groupName()
+		isGroupPrimary := !groupNames[group] && !shadowGroups[group]
+		groupNames[group] = true
+		var builderTLSConfig *tls.Config
+		if ok && config.TLS != nil {
+			var err error
+			builderTLSConfig, err = buildClientTLSConfig(config.TLS)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load TLS config for builder %s: %w", builder.String(), err)
+			}
+		}
+
+		timeout, methodTimeouts := opts.BuilderTimeout, opts.MethodTimeouts
+		if ok {
+			timeout, methodTimeouts = config.timeouts(timeout, methodTimeouts)
+		}
+		entry := buildProxyEntry(builder, timeout, builderTLSConfig)
+		if backend, ok := opts.Backends[builder.String()]; ok {
+			entry.Backend = backend
+		}
+		if opts.Chaos != nil {
+			entry.Backend = opts.Chaos.wrap(builder.String(), entry.Backend)
+		}
+		entry.MethodTimeouts = methodTimeouts
+		entry.MaxResponseSize = opts.MaxResponseSize
+		if ok && config.MaxResponseSize != 0 {
+			entry.MaxResponseSize = config.MaxResponseSize
+		}
+		entry.Group = group
+		entry.Retry = opts.Retry
+		if ok && config.Retry != nil {
+			entry.Retry = config.Retry.withDefaults(opts.Retry)
+		}
+		if ok {
+			entry.RequestEncoding = config.RequestEncoding
+			entry.AcceptEncoding = config.AcceptEncoding
+			entry.StripPayloadAttributes = config.StripPayloadAttributes
+		}
+		// the primary's response goes to the beacon node, which would get no payloadId to build blocks with
+		if entry.StripPayloadAttributes && isGroupPrimary {
+			return nil, fmt.Errorf("%w: builder %s of group %s", errStripPrimaryBuilder, builder.String(), group)
+		}
+
+		if ok && config.Async {
+			if isGroupPrimary {
+				return nil, fmt.Errorf("%w: builder %s of group %s", errAsyncPrimaryBuilder, builder.String(), group)
+			}
+			queue, err := newBuilderQueue(&entry, opts.QueueSize, opts.QueueDir, opts.Log)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create queue for builder %s: %w", builder.String(), err)
+			}
+			builderQueues = append(builderQueues, queue)
+			continue
+		}
+		if ok && config.Shadow {
+			if isGroupPrimary {
+				return nil, fmt.Errorf("%w: builder %s of group %s", errShadowPrimaryBuilder, builder.String(), group)
+			}
+			entry.Shadow = true
+			shadowBuilders = append(shadowBuilders, &shadowBuilder{entry: &entry})
+			continue
+		}
+		builderEntries = append(builderEntries, &entry)
+	}
+
+	if opts.Chaos != nil {
+		if err := opts.Chaos.validate(); err != nil {
+			return nil, fmt.Errorf("invalid chaos config: %w", err)
+		}
+	}
+
+	if len(builderEntries) == 0 {
+		return nil, fmt.Errorf("%w: all builders are async or shadow builders", errNoBuilders)
+	}
+
+	groups, builderEntries, err := groupBuilders(builderEntries, opts.PreferredGroup)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, opts.PreferredGroup)
+	}
+
+	allEntries := append([]*ProxyEntry{}, builderEntries...)
+	for _, queue := range builderQueues {
+		allEntries = append(allEntries, queue.entry)
+	}
+	for _, shadow := range shadowBuilders {
+		allEntries = append(allEntries, shadow.entry)
+	}
+	routes, err := buildRoutes(opts.Routes, allEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider := opts.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = noop.NewTracerProvider()
+	}
+	tracer := tracerProvider.Tracer(tracerName)
+
+	proxyQueueSize := opts.ProxyQueueSize
+	if proxyQueueSize <= 0 {
+		proxyQueueSize = defaultProxyQueueSize
+	}
+	proxyWait := opts.ProxyWait
+	if proxyWait <= 0 {
+		proxyWait = defaultProxyWait
+	}
+	var proxyForwarders []*proxyForwarder
+	for _, proxy := range opts.Proxies {
+		entry := buildProxyEntry(proxy, opts.ProxyTimeout, nil)
+		proxyForwarders = append(proxyForwarders, newProxyForwarder(&entry, opts.ProxyWorkers, proxyQueueSize, tracer, opts.Log))
+	}
+
+	instanceID := opts.InstanceID
+	if instanceID == "" {
+		instanceID = randomInstanceID()
+	}
+
+	service := &ProxyService{
+		listenAddr:      opts.ListenAddr,
+		tlsConfig:       tlsConfig,
+		builderEntries:  builderEntries,
+		builderQueues:   builderQueues,
+		shadowBuilders:  shadowBuilders,
+		groups:          groups,
+		routes:          routes,
+		proxyForwarders: proxyForwarders,
+		proxyWait:       proxyWait,
+		beacons:         beacon.NewTracker(opts.Log),
+		instanceID:      instanceID,
+		maxHops:         opts.MaxHops,
+		clientCancel:    clientCancel,
+		jwtSecret:       opts.JWTSecret,
+		beaconACL:       opts.BeaconACL,
+		proxyACL:        opts.ProxyACL,
+		trustedProxies:  opts.TrustedProxies,
+		rateLimiter:     newRateLimiter(opts.RateLimit, opts.RateBurst),
+		tracer:          tracer,
+		log:             opts.Log,
+	}
+	service.handler = service.chain(opts.PreParseMiddlewares, opts.Middlewares)
+	return service, nil
+}
+
+// StartHTTPServer starts the HTTP server for the proxy service
+func (p *ProxyService) StartHTTPServer() error {
+	p.srvMu.Lock()
+	if p.srv != nil {
+		p.srvMu.Unlock()
+		return errServerAlreadyRunning
+	}
+
+	listeners, err := listenAll(p.listenAddr)
+	if err != nil {
+		p.srvMu.Unlock()
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:      p.listenAddr,
+		Handler:   http.HandlerFunc(p.ServeHTTP),
+		TLSConfig: p.tlsConfig,
+	}
+	p.srv = srv
+	p.srvMu.Unlock()
+
+	errC := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			if p.tlsConfig != nil {
+				errC <- srv.ServeTLS(listener, "", "")
+			} else {
+				errC <- srv.Serve(listener)
+			}
+		}(listener)
+	}
+
+	err = <-errC
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// shutdownServer stops the HTTP server if it was started, pending requests get up to shutdownTimeout to finish
+func (p *ProxyService) shutdownServer() {
+	p.srvMu.Lock()
+	srv := p.srv
+	p.srvMu.Unlock()
+	if srv == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		p.log.WithError(err).Warn("failed to shut down the HTTP server gracefully")
+		srv.Close() //nolint:errcheck
+	}
+}
+
+// Close stops the HTTP server and the delivery of queued requests to async builders, waits for pending requests
+// to other proxies and shadow builders and closes the builder backends
+func (p *ProxyService) Close() {
+	p.shutdownServer()
+	for _, queue := range p.builderQueues {
+		queue.close()
+	}
+	for _, forwarder := range p.proxyForwarders {
+		forwarder.close()
+	}
+	p.shadowMu.Lock()
+	p.shadowClosed = true
+	p.shadowMu.Unlock()
+	p.shadowWG.Wait()
+	for _, entry := range p.builderEntries {
+		if closer, ok := entry.Backend.(io.Closer); ok {
+			closer.Close() //nolint:errcheck
+		}
+	}
+	for _, shadow := range p.shadowBuilders {
+		if closer, ok := shadow.entry.Backend.(io.Closer); ok {
+			closer.Close() //nolint:errcheck
+		}
+	}
+}
+
+func (p *ProxyService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	isWebSocket := websocket.IsWebSocketUpgrade(req)
+
+	if status, err := p.checkAccess(req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(engineapi.NewJSONRPCError(nil, engineapi.CodeServerError, err.Error())) //nolint:errcheck
+		return
+	}
+
+	// return OK for all GET requests, used for debug
+	if req.Method == http.MethodGet && !isWebSocket {
+		if req.URL.Path == "/stats" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p.Stats()) //nolint:errcheck
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if isWebSocket {
+		p.serveWebSocket(w, req)
+		return
+	}
+
+	p.handler(w, &Request{HTTP: req})
+}
+
+// forwardToBuilders sends the request to the builders and writes the response to the beacon node
+func (p *ProxyService) forwardToBuilders(w http.ResponseWriter, r *Request) {
+	req := r.HTTP
+	// the primary builder's response is streamed to the beacon node while the other builders are still waited for.
+	// WebSocket responses are sent as one message, so they are buffered and can still fall back to another builder.
+	var stream func(BuilderResponse, io.Reader) error
+	if !r.WebSocket {
+		stream = func(response BuilderResponse, body io.Reader) error {
+			if err := writeBuilderResponse(w, req, response, body); err != nil {
+				return err
+			}
+			return http.NewResponseController(w).Flush()
+		}
+	}
+	builderResponse, err := p.callBuilders(req, r.JSON, r.Body, stream)
+
+	if builderResponse.Streamed {
+		if builderResponse.streamErr != nil {
+			// the beacon node got part of the body, abort the connection so it doesn't use it as the response
+			panic(http.ErrAbortHandler)
+		}
+		return
+	} else if errors.Is(err, errBuilderTimeout) {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	writeBuilderResponse(w, req, builderResponse, bytes.NewReader(builderResponse.Body)) //nolint:errcheck
+}
+
+// writeBuilderResponse writes the response of a builder to the beacon node, the body is decompressed if the
+// beacon node doesn't accept the builder's encoding
+func writeBuilderResponse(w http.ResponseWriter, req *http.Request, response BuilderResponse, body io.Reader) error {
+	copyHeader(w.Header(), response.Header)
+	if encoding := response.Header.Get("Content-Encoding"); !compression.Accepts(req.Header, encoding) {
+		// the builder's encoding was negotiated independently of the beacon node
+		w.Header().Del("Content-Encoding")
+		w.Header().Del("Content-Length")
+		decoded, err := compression.DecodeReader(encoding, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return err
+		}
+		defer decoded.Close()
+		body = decoded
+	}
+	w.WriteHeader(response.StatusCode)
+	_, err := io.Copy(w, body)
+	return err
+}
+
+// callBuilders sends the request to all builders and returns the response of the primary builder, or of another
+// builder if the primary builder failed. If stream is set, the body of the primary builder's response is passed
+// to it as soon as the response headers are received instead of being buffered.
+func (p *ProxyService) callBuilders(req *http.Request, requestJSON engineapi.JSONRPCRequest, bodyBytes []byte, stream func(BuilderResponse, io.Reader) error) (BuilderResponse, error) {
+	numSuccessRequestsToBuilder := 0
+	numTimeouts := 0
+	var mu sync.Mutex
+	// the bodies of the other builders are only needed as fallback until the primary builder responded
+	var primaryResponded atomic.Bool
+
+	var responses []BuilderResponse
+	var primaryReponse BuilderResponse
+	preferredGroup := p.preferredGroup()
+
+	// Queue the request for async builders, they are not waited for
+	for _, queue := range p.builderQueues {
+		if p.isRouted(requestJSON.Method, queue.entry) {
+			queue.enqueue(req, bodyBytes)
+		}
+	}
+	// Shadow builders are compared with the response once it is known, they are not waited for either
+	compareShadows := p.callShadowBuilders(req, requestJSON, bodyBytes)
+
+	// Call the builders the method is routed to, the first of them is the primary builder of the method
+	entries := p.routedEntries(requestJSON.Method)
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		wg.Add(1)
+		go func(entry *ProxyEntry) {
+			defer wg.Done()
+			url := entry.URL
+			isPrimary := entry == entries[0]
+			resp, err := p.sendBuilderRequest(req, entry, requestJSON.Method, bodyBytes)
+			if err == nil && entry.MaxResponseSize > 0 && resp.ContentLength > entry.MaxResponseSize {
+				resp.Body.Close()
+				err = errResponseTooLarge
+			}
+			if err != nil {
+				if p.logBuilderError(err, url, requestJSON.Method) {
+					mu.Lock()
+					numTimeouts++
+					mu.Unlock()
+				}
+				return
+			}
+			defer resp.Body.Close()
+
+			builderResponse := BuilderResponse{Header: resp.Header, URL: url, StatusCode: resp.StatusCode, Group: entry.Group}
+			body := newLimitedReader(resp.Body, entry.MaxResponseSize)
+			encoding := resp.Header.Get("Content-Encoding")
+
+			switch {
+			case isPrimary && stream != nil:
+				// the beginning of the body is read before the headers are sent, so the other builders are still
+				// used if it fails, which covers the whole body of most responses
+				prefix, err := io.ReadAll(io.LimitReader(body, statusPrefixSize))
+				if err != nil {
+					if p.logBuilderError(err, url, requestJSON.Method) {
+						mu.Lock()
+						numTimeouts++
+						mu.Unlock()
+					}
+					return
+				}
+				primaryResponded.Store(true)
+				// the beacon node already got the headers, so the response is used even if streaming fails
+				if err := stream(builderResponse, io.MultiReader(bytes.NewReader(prefix), body)); err != nil {
+					p.logBuilderError(fmt.Errorf("failed to stream response: %w", err), url, requestJSON.Method)
+					builderResponse.streamErr = err
+				}
+				builderResponse.Streamed = true
+				builderResponse.Status = p.readStatus(requestJSON.Method, encoding, prefix, url)
+			case !isPrimary && primaryResponded.Load():
+				prefix := &prefixWriter{limit: statusPrefixSize}
+				if _, err := io.Copy(prefix, body); err != nil {
+					p.logBuilderError(err, url, requestJSON.Method)
+					return
+				}
+				builderResponse.Status = p.readStatus(requestJSON.Method, encoding, prefix.buf, url)
+			default:
+				builderResponse.Body, err = io.ReadAll(body)
+				if err != nil {
+					if p.logBuilderError(err, url, requestJSON.Method) {
+						mu.Lock()
+						numTimeouts++
+						mu.Unlock()
+					}
+					return
+				}
+				builderResponse.Status = p.readStatus(requestJSON.Method, encoding, builderResponse.Body, url)
+				if isPrimary {
+					primaryResponded.Store(true)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			responses = append(responses, builderResponse)
+
+			log := p.log.WithFields(logrus.Fields{
+				"method": requestJSON.Method,
+				"id":     requestJSON.ID,
+				"status": builderResponse.Status,
+				"url":    url.String(),
+			})
+			if builderResponse.Body != nil && p.log.Logger.IsLevelEnabled(logrus.DebugLevel) {
+				log = log.WithField("response", string(getResponseBody(builderResponse)))
+			}
+			log.Debug("response received from builder")
+
+			// Use response from first EL endpoint specificed and fallback if response not found, preferably
+			// to a builder of the same group
+			switch {
+			case isPrimary:
+				primaryReponse = builderResponse
+			case builderResponse.Body == nil:
+			case primaryReponse.URL == nil:
+				primaryReponse = builderResponse
+			case primaryReponse.Group != preferredGroup && builderResponse.Group == preferredGroup:
+				primaryReponse = builderResponse
+			}
+
+			numSuccessRequestsToBuilder++
+		}(entry)
+	}
+
+	// Wait for all requests to complete...
+	wg.Wait()
+	compareShadows(primaryReponse)
+
+	if len(entries) == 0 {
+		return primaryReponse, fmt.Errorf("%w %s", errNoRoutedBuilders, requestJSON.Method)
+	}
+	if numSuccessRequestsToBuilder == 0 && numTimeouts == len(entries) {
+		return primaryReponse, errBuilderTimeout
+	}
+	if numSuccessRequestsToBuilder == 0 {
+		return primaryReponse, errNoSuccessfulBuilderResponse
+	}
+
+	if engineapi.IsEngineRequest(requestJSON.Method) {
+		p.logResponseDifferences(requestJSON.Method, responses)
+	}
+
+	return primaryReponse, nil
+}
+
+// logBuilderError logs a failed builder request and returns true if it timed out
+func (p *ProxyService) logBuilderError(err error, url *url.URL, method string) bool {
+	log := p.log.WithError(err).WithFields(logrus.Fields{"url": url.String(), "method": method})
+	switch {
+	case errors.Is(err, errBuilderTimeout), errors.Is(err, context.DeadlineExceeded):
+		log.Warn("builder request timed out")
+		return true
+	case errors.Is(err, context.Canceled):
+		log.Debug("builder request cancelled by the beacon node")
+	case errors.Is(err, errResponseTooLarge):
+		log.Error("builder response too large")
+	default:
+		log.Error("error sending request to builder")
+	}
+	return false
+}
+
+// readStatus reads the payload status of a builder response and logs if it can't be read
+func (p *ProxyService) readStatus(method, encoding string, body []byte, url *url.URL) string {
+	status, err := readResponseStatus(method, encoding, body)
+	if err != nil {
+		p.log.WithError(err).WithFields(logrus.Fields{
+			"method": method,
+			"url":    url.String(),
+		}).Error("error reading status from EL response")
+	}
+	return status
+}
+
+// cancelWithClient returns true if the request to the builder is cancelled when the beacon node cancels its request
+func (p *ProxyService) cancelWithClient(entry *ProxyEntry, method string) bool {
+	if entry.Shadow {
+		// shadow builders are still waited for after the beacon node got its response
+		return false
+	}
+	switch p.clientCancel {
+	case ClientCancelAll:
+		return true
+	case ClientCancelPrimary:
+		entries := p.routedEntries(method)
+		return len(entries) > 0 && entry == entries[0]
+	default:
+		return false
+	}
+}
+
+// callProxies queues the request to be forwarded to the other proxies, the returned WaitGroup is done
+// once all proxies responded or the request was dropped
+func (p *ProxyService) callProxies(req *http.Request, bodyBytes []byte) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	if hops := len(getVia(req.Header)); p.maxHops > 0 && hops >= p.maxHops && len(p.proxyForwarders) > 0 {
+		p.log.WithField("hops", hops).Warn("request reached max hops, not forwarding to other proxies")
+		return &wg
+	}
+
+	// the wait for space in the queues is bounded for all proxies together
+	ctx, cancel := context.WithTimeout(context.Background(), p.proxyWait)
+	defer cancel()
+	for _, forwarder := range p.proxyForwarders {
+		wg.Add(1)
+		proxyReq := BuildProxyRequest(req, bodyBytes)
+		// keep the span of the request, the forward itself is not cancelled with it
+		proxyReq = proxyReq.WithContext(context.WithoutCancel(req.Context()))
+		appendVia(proxyReq.Header, p.instanceID)
+		forwarder.enqueue(ctx, proxyReq, wg.Done)
+	}
+	return &wg
+}
+
+func (p *ProxyService) checkBeaconRequest(bodyBytes []byte, remoteHost string) (engineapi.JSONRPCRequest, error) {
+	var requestJSON engineapi.JSONRPCRequest
+	var batchRequestJSON []engineapi.JSONRPCRequest
+	err := json.Unmarshal(bodyBytes, &requestJSON)
+
+	if err != nil {
+		p.log.WithError(err).Warn("failed to decode request body json, trying to decode as batch request")
+		// may be batch request
+		if err := json.Unmarshal(bodyBytes, &batchRequestJSON); err != nil {
+			p.log.WithError(err).Error("failed to decode request body json as batch request")
+			return requestJSON, err
+		}
+		// not interested in batch requests
+		return requestJSON, nil
+	}
+
+	p.log.WithFields(logrus.Fields{
+		"method": requestJSON.Method,
+		"id":     requestJSON.ID,
+	}).Debug("request received from beacon node")
+
+	p.beacons.Update(requestJSON, remoteHost)
+
+	return requestJSON, nil
+}
+
+func (p *ProxyService) shouldFilterRequest(remoteHost, method string) bool {
+	if !engineapi.IsEngineRequest(method) {
+		return true
+	}
+
+	if !strings.HasPrefix(method, engineapi.NewPayload) && !p.beacons.IsBest(remoteHost) {
+		return true
+	}
+
+	return false
+}
+
+// encodeBody returns the request body sent to the entry, rewritten for the entry's settings and compressed with
+// its request encoding
+func (e *ProxyEntry) encodeBody(method string, bodyBytes []byte) ([]byte, error) {
+	if e.StripPayloadAttributes && strings.HasPrefix(method, engineapi.ForkchoiceUpdated) {
+		var err error
+		bodyBytes, err = engineapi.StripPayloadAttributes(bodyBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return compression.Encode(e.RequestEncoding, bodyBytes)
+}
+
+// buildRequest builds the request to the entry, bodyBytes must already be compressed with the entry's request encoding
+func (e *ProxyEntry) buildRequest(req *http.Request, bodyBytes []byte) *http.Request {
+	proxyReq := BuildProxyRequest(req, bodyBytes)
+	if e.RequestEncoding != "" && e.RequestEncoding != compression.Identity {
+		proxyReq.Header.Set("Content-Encoding", e.RequestEncoding)
+	}
+	if e.AcceptEncoding != "" {
+		proxyReq.Header.Set("Accept-Encoding", e.AcceptEncoding)
+	}
+	return proxyReq
+}
+
+func buildProxyEntry(proxyURL *url.URL, timeout time.Duration, tlsConfig *tls.Config) ProxyEntry {
+	return ProxyEntry{Backend: newBackend(proxyURL, timeout, tlsConfig), URL: proxyURL, Timeout: timeout}
+}
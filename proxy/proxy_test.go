@@ -0,0 +1,601 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	newPayloadPath       = "engine_newPayloadV1"
+	forkchoicePath       = "engine_forkchoiceUpdatedV1"
+	transitionConfigPath = "engine_exchangeTransitionConfigurationV1"
+
+	// testLog is used to log information in the test methods
+	testLog = logrus.WithField("testing", true)
+
+	from = "10.0.0.0:1234"
+)
+
+type testBackend struct {
+	proxyService *ProxyService
+	builders     []*mocks.Server
+	proxies      []*mocks.Server
+}
+
+// newTestBackend creates a new backend, initializes mock builders and return the instance. The options of the
+// proxy service can be changed with modify, e.g. to configure builders by their urls in opts.Builders.
+func newTestBackend(t *testing.T, numBuilders, numProxies int, builderTimeout, proxyTimeout time.Duration, modify ...func(opts *ProxyServiceOpts)) *testBackend {
+	backend := testBackend{
+		builders: createMockServers(t, numBuilders),
+		proxies:  createMockServers(t, numProxies),
+	}
+
+	builderUrls := getURLs(t, backend.builders)
+
+	proxyUrls := getURLs(t, backend.proxies)
+
+	opts := ProxyServiceOpts{
+		Log:            testLog,
+		ListenAddr:     "localhost:12345",
+		Builders:       builderUrls,
+		BuilderTimeout: builderTimeout,
+		Proxies:        proxyUrls,
+		ProxyTimeout:   proxyTimeout,
+	}
+	for _, m := range modify {
+		m(&opts)
+	}
+	service, err := NewProxyService(opts)
+	require.NoError(t, err)
+
+	backend.proxyService = service
+	return &backend
+}
+
+func createMockServers(t *testing.T, num int) []*mocks.Server {
+	servers := make([]*mocks.Server, num)
+	for i := 0; i < num; i++ {
+		servers[i] = mocks.NewServer(t)
+		servers[i].Response = []byte(mocks.NewPayloadResponseValid)
+	}
+	return servers
+}
+
+// get urls from the mock servers
+func getURLs(t *testing.T, servers []*mocks.Server) []*url.URL {
+	urls := make([]*url.URL, len(servers))
+	for i := 0; i < len(servers); i++ {
+		url, err := url.Parse(servers[i].Server.URL)
+		require.NoError(t, err)
+		urls[i] = url
+	}
+	return urls
+}
+
+func (be *testBackend) request(t *testing.T, payload []byte, from string) *httptest.ResponseRecorder {
+	var req *http.Request
+	var err error
+
+	if payload == nil {
+		req, err = http.NewRequest(http.MethodGet, "/", nil)
+	} else {
+		req, err = http.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	}
+
+	require.NoError(t, err)
+	req.RemoteAddr = from
+	rr := httptest.NewRecorder()
+	be.proxyService.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRequests(t *testing.T) {
+	t.Run("test new payload request", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+
+		backend.builders[0].Response = []byte(mocks.NewPayloadResponseValid)
+		backend.builders[1].Response = []byte(mocks.NewPayloadResponseValid)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(newPayloadPath))
+
+		var resp engineapi.JSONRPCResponse
+		resp.Result = new(engineapi.PayloadStatusV1)
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.Equal(t, rr.Body.String(), mocks.NewPayloadResponseValid)
+	})
+
+	t.Run("test forkchoice updated request", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+
+		backend.builders[0].Response = []byte(mocks.ForkchoiceResponse)
+		backend.builders[1].Response = []byte(mocks.ForkchoiceResponse)
+
+		rr := backend.request(t, []byte(mocks.ForkchoiceRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(forkchoicePath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(forkchoicePath))
+
+		var resp engineapi.JSONRPCResponse
+		resp.Result = new(engineapi.ForkChoiceResponse)
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.Equal(t, rr.Body.String(), mocks.ForkchoiceResponse)
+	})
+
+	t.Run("test engine request", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+
+		backend.builders[0].Response = []byte(mocks.TransitionResponse)
+		backend.builders[1].Response = []byte(mocks.TransitionResponse)
+
+		rr := backend.request(t, []byte(mocks.TransitionRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(transitionConfigPath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(transitionConfigPath))
+
+		var resp engineapi.JSONRPCResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.Equal(t, rr.Body.String(), mocks.TransitionResponse)
+	})
+
+	t.Run("service should send request to builders as well as other proxies", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 2, time.Second, time.Second)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(newPayloadPath))
+
+		backend.proxyService.Close()
+		require.Equal(t, 1, backend.proxies[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, backend.proxies[1].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should filter requests not from engine or builder namespace", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		rr := backend.request(t, []byte(mocks.EthChainIDRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		require.Equal(t, rr.Body.String(), "")
+	})
+
+	t.Run("should filter requests not from the best synced", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 2, time.Second, time.Second)
+
+		rr := backend.request(t, []byte(mocks.ForkchoiceRequest), "localhost:8080")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		rr = backend.request(t, []byte(mocks.ForkchoiceRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(forkchoicePath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(forkchoicePath))
+	})
+
+	t.Run("should filter requests not from the best synced on IPv6", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		rr := backend.request(t, []byte(mocks.ForkchoiceRequest), "[2001:db8::1]:5052")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		// same beacon node on another port
+		rr = backend.request(t, []byte(mocks.ForkchoiceRequest), "[2001:db8::1]:5053")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		rr = backend.request(t, []byte(mocks.ForkchoiceRequest), "[2001:db8::2]:5052")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		require.Equal(t, "2001:db8::1", backend.proxyService.beacons.Best().Addr)
+		require.Equal(t, 2, backend.builders[0].GetRequestCount(forkchoicePath))
+	})
+
+	t.Run("service should not filter new payload requests from any beacon node", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 2, time.Second, time.Second)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), "localhost:8080")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		rr = backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		require.Equal(t, 2, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 2, backend.builders[1].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should return status ok for GET requests", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		rr := backend.request(t, nil, from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+}
+
+func TestBuilders(t *testing.T) {
+	t.Run("builders have different responses should return response of first builder", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+
+		backend.builders[0].Response = []byte(mocks.NewPayloadResponseSyncing)
+		backend.builders[1].Response = []byte(mocks.NewPayloadResponseValid)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(newPayloadPath))
+
+		var resp engineapi.JSONRPCResponse
+		resp.Result = new(engineapi.PayloadStatusV1)
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.Equal(t, rr.Body.String(), mocks.NewPayloadResponseSyncing)
+	})
+
+	t.Run("only first builder online should return response of first builder", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+
+		backend.builders[0].Response = []byte(mocks.ForkchoiceResponse)
+		backend.builders[1].Server.Close()
+
+		rr := backend.request(t, []byte(mocks.ForkchoiceRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(forkchoicePath))
+		require.Equal(t, 0, backend.builders[1].GetRequestCount(forkchoicePath))
+
+		var resp engineapi.JSONRPCResponse
+		resp.Result = new(engineapi.ForkChoiceResponse)
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.Equal(t, rr.Body.String(), mocks.ForkchoiceResponse)
+	})
+
+	t.Run("if first builder is offline proxy should fallback to another builder", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+
+		backend.builders[1].Response = []byte(mocks.NewPayloadResponseSyncing)
+		backend.builders[0].Server.Close()
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(newPayloadPath))
+
+		var resp engineapi.JSONRPCResponse
+		resp.Result = new(engineapi.PayloadStatusV1)
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		require.Equal(t, rr.Body.String(), mocks.NewPayloadResponseSyncing)
+	})
+
+	t.Run("all builders are down", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		backend.builders[0].Server.Close()
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+}
+
+func TestUpdateBestBeaconNode(t *testing.T) {
+	var data engineapi.JSONRPCRequest
+	json.Unmarshal([]byte(mocks.ForkchoiceRequestWithPayloadAttributesV1), &data)
+
+	data.Params[1].(*engineapi.PayloadAttributes).Timestamp = 10
+	higherTimestampFcu, err := json.Marshal(data)
+	require.NoError(t, err)
+
+	json.Unmarshal([]byte(mocks.ForkchoiceRequestWithPayloadAttributesV2), &data)
+
+	data.Params[1].(*engineapi.PayloadAttributes).Timestamp = 1
+	lowerTimestampFcu, err := json.Marshal(data)
+	require.NoError(t, err)
+
+	json.Unmarshal([]byte(mocks.ForkchoiceRequest), &data)
+
+	t.Run("should update address to sync if sync target address is not set", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.NotNil(t, backend.proxyService.beacons.Best())
+	})
+
+	t.Run("should update address to sync if higher current timestamp is received", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		backend.request(t, lowerTimestampFcu, from)
+		require.NotNil(t, backend.proxyService.beacons.Best())
+		require.Equal(t, backend.proxyService.beacons.Best().Timestamp, uint64(1))
+
+		backend.request(t, higherTimestampFcu, from)
+		require.NotNil(t, backend.proxyService.beacons.Best())
+		require.Equal(t, uint64(10), backend.proxyService.beacons.Best().Timestamp)
+	})
+
+	t.Run("should not update address to sync if timestamp received is not higher than previously received", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		backend.request(t, higherTimestampFcu, from)
+		require.NotNil(t, backend.proxyService.beacons.Best())
+		require.Equal(t, backend.proxyService.beacons.Best().Timestamp, uint64(10))
+
+		backend.request(t, higherTimestampFcu, from)
+		require.NotNil(t, backend.proxyService.beacons.Best())
+		require.Equal(t, backend.proxyService.beacons.Best().Timestamp, uint64(10))
+	})
+}
+
+func TestProxies(t *testing.T) {
+	newRequest := func(t *testing.T) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		return req
+	}
+
+	t.Run("should track successful and failed requests per proxy", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 2, time.Second, time.Second)
+		backend.proxies[1].NumFailures = 1
+
+		backend.proxyService.callProxies(newRequest(t), []byte(mocks.NewPayloadRequest)).Wait()
+
+		stats := backend.proxyService.Stats()
+		require.Len(t, stats.Proxies, 2)
+		require.Equal(t, uint64(1), stats.Proxies[0].Success)
+		require.Equal(t, uint64(0), stats.Proxies[0].Failure)
+		require.Equal(t, uint64(0), stats.Proxies[1].Success)
+		require.Equal(t, uint64(1), stats.Proxies[1].Failure)
+	})
+
+	t.Run("should drop requests if the proxy queue stays full", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 1, time.Second, time.Second, func(opts *ProxyServiceOpts) {
+			opts.ProxyQueueSize = 1
+			opts.ProxyWait = 20 * time.Millisecond
+		})
+		backend.proxies[0].ResponseDelay = 200 * time.Millisecond
+
+		// the single worker is busy with the first request, the second fills the queue and the others are dropped
+		first := backend.proxyService.callProxies(newRequest(t), []byte(mocks.NewPayloadRequest))
+		require.Eventually(t, func() bool { return backend.proxies[0].GetRequestCount(newPayloadPath) == 1 }, time.Second, 5*time.Millisecond)
+		start := time.Now()
+		pending := []*sync.WaitGroup{first}
+		for i := 0; i < 3; i++ {
+			pending = append(pending, backend.proxyService.callProxies(newRequest(t), []byte(mocks.NewPayloadRequest)))
+		}
+		require.Less(t, time.Since(start), 150*time.Millisecond)
+		for _, wg := range pending {
+			wg.Wait()
+		}
+
+		stats := backend.proxyService.Stats()
+		require.Equal(t, uint64(2), stats.Proxies[0].Success)
+		require.Equal(t, uint64(2), stats.Proxies[0].Dropped)
+	})
+
+	t.Run("should wait for space in the proxy queue", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 1, time.Second, time.Second, func(opts *ProxyServiceOpts) {
+			opts.ProxyQueueSize = 1
+			opts.ProxyWait = time.Second
+		})
+		backend.proxies[0].ResponseDelay = 50 * time.Millisecond
+
+		var pending []*sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			pending = append(pending, backend.proxyService.callProxies(newRequest(t), []byte(mocks.NewPayloadRequest)))
+		}
+		for _, wg := range pending {
+			wg.Wait()
+		}
+
+		stats := backend.proxyService.Stats()
+		require.Equal(t, uint64(3), stats.Proxies[0].Success)
+		require.Equal(t, uint64(0), stats.Proxies[0].Dropped)
+	})
+
+	t.Run("should serve stats on GET /stats", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 1, time.Second, time.Second)
+		backend.proxyService.proxyForwarders[0].entry.URL.User = url.UserPassword("user", "secret")
+		getStats := func() *httptest.ResponseRecorder {
+			req, err := http.NewRequest(http.MethodGet, "/stats", nil)
+			require.NoError(t, err)
+			req.RemoteAddr = from
+			rr := httptest.NewRecorder()
+			backend.proxyService.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := getStats()
+		require.Equal(t, http.StatusOK, rr.Code)
+		var stats Stats
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+		require.Len(t, stats.Proxies, 1)
+		// credentials in urls are not served
+		require.Equal(t, backend.proxies[0].Server.URL, stats.Proxies[0].URL)
+
+		backend.proxyService.beaconACL, _ = NewACL("", "10.0.0.0/8")
+		rr = getStats()
+		require.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestLoopPrevention(t *testing.T) {
+	t.Run("should not forward requests in a loop between proxies", func(t *testing.T) {
+		builders := createMockServers(t, 2)
+		services := make([]*ProxyService, 2)
+		servers := make([]*httptest.Server, 2)
+		for i := range servers {
+			servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				services[i].ServeHTTP(w, r)
+			}))
+			defer servers[i].Close()
+		}
+
+		for i := range services {
+			proxyURL, err := url.Parse(servers[1-i].URL)
+			require.NoError(t, err)
+			services[i], err = NewProxyService(ProxyServiceOpts{
+				Log:            testLog,
+				Builders:       getURLs(t, builders[i:i+1]),
+				BuilderTimeout: time.Second,
+				Proxies:        []*url.URL{proxyURL},
+				ProxyTimeout:   time.Second,
+				InstanceID:     fmt.Sprintf("proxy-%d", i),
+			})
+			require.NoError(t, err)
+		}
+
+		resp, err := http.Post(servers[0].URL, "application/json", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		services[0].Close()
+		services[1].Close()
+		require.Equal(t, 1, builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, builders[1].GetRequestCount(newPayloadPath))
+		require.Equal(t, uint64(1), services[1].Stats().Proxies[0].Failure)
+	})
+
+	t.Run("should not forward requests to proxies after max hops", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 1, time.Second, time.Second)
+		backend.proxyService.maxHops = 2
+
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		req.Header.Set(viaHeader, "proxy-a, proxy-b")
+		req.RemoteAddr = from
+		rr := httptest.NewRecorder()
+		backend.proxyService.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		backend.proxyService.Close()
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 0, backend.proxies[0].GetRequestCount(newPayloadPath))
+	})
+}
+
+func TestVia(t *testing.T) {
+	header := http.Header{}
+	require.Empty(t, getVia(header))
+
+	appendVia(header, "proxy-a")
+	appendVia(header, "proxy-b")
+	require.Equal(t, "proxy-a, proxy-b", header.Get(viaHeader))
+	require.Equal(t, []string{"proxy-a", "proxy-b"}, getVia(header))
+	require.True(t, hasVia(header, "proxy-b"))
+	require.False(t, hasVia(header, "proxy-c"))
+}
+
+func TestClientCancel(t *testing.T) {
+	// cancelledRequest sends a request which the beacon node cancels after 50ms and returns the time until the proxy returned
+	cancelledRequest := func(t *testing.T, backend *testBackend) (*httptest.ResponseRecorder, time.Duration) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		req.RemoteAddr = from
+
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		rr := httptest.NewRecorder()
+		backend.proxyService.ServeHTTP(rr, req)
+		return rr, time.Since(start)
+	}
+
+	t.Run("should wait for all builders by default", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.builders[0].ResponseDelay = 200 * time.Millisecond
+
+		rr, duration := cancelledRequest(t, backend)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.GreaterOrEqual(t, duration, 200*time.Millisecond)
+	})
+
+	t.Run("should cancel the primary builder request with the client", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.proxyService.clientCancel = ClientCancelPrimary
+		backend.builders[0].ResponseDelay = 500 * time.Millisecond
+		backend.builders[1].ResponseDelay = 200 * time.Millisecond
+
+		// the backup builder still gets the request
+		rr, duration := cancelledRequest(t, backend)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.GreaterOrEqual(t, duration, 200*time.Millisecond)
+		require.Less(t, duration, 500*time.Millisecond)
+	})
+
+	t.Run("should cancel all builder requests with the client", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.proxyService.clientCancel = ClientCancelAll
+		backend.builders[0].ResponseDelay = 500 * time.Millisecond
+		backend.builders[1].ResponseDelay = 500 * time.Millisecond
+
+		rr, duration := cancelledRequest(t, backend)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+		require.Less(t, duration, 500*time.Millisecond)
+	})
+
+	t.Run("should reject invalid modes", func(t *testing.T) {
+		_, err := NewProxyService(ProxyServiceOpts{
+			Log:          testLog,
+			Builders:     getURLs(t, createMockServers(t, 1)),
+			ClientCancel: "backup",
+		})
+		require.ErrorIs(t, err, errInvalidClientCancel)
+	})
+}
+
+func TestStripPayloadAttributes(t *testing.T) {
+	builders := createMockServers(t, 2)
+	urls := getURLs(t, builders)
+	var received struct {
+		Params []json.RawMessage `json:"params"`
+	}
+	stripped := HandlerBackend{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&received))
+		w.Write([]byte(mocks.ForkchoiceResponse)) //nolint:errcheck
+	})}
+	service, err := NewProxyService(ProxyServiceOpts{
+		Log:            testLog,
+		Builders:       urls,
+		BuilderTimeout: time.Second,
+		BuilderConfigs: map[string]*BuilderConfig{urls[1].String(): {StripPayloadAttributes: true}},
+		Backends:       map[string]Backend{urls[1].String(): stripped},
+	})
+	require.NoError(t, err)
+	backend := testBackend{proxyService: service, builders: builders}
+	primaryResponse := strings.Replace(mocks.ForkchoiceResponse, `"payloadId": null`, `"payloadId": "0x0000000000000001"`, 1)
+	builders[0].Response = []byte(primaryResponse)
+
+	request := `{"jsonrpc":"2.0","method":"engine_forkchoiceUpdatedV1","params":[{"headBlockHash":"0x3b8fb240d288781d4aac94d3fd16809ee413bc99294a085798a589dae51ddd4a","safeBlockHash":"0x3b8fb240d288781d4aac94d3fd16809ee413bc99294a085798a589dae51ddd4a","finalizedBlockHash":"0x0000000000000000000000000000000000000000000000000000000000000000"},{"timestamp":"0x5","prevRandao":"0x0000000000000000000000000000000000000000000000000000000000000000","suggestedFeeRecipient":"0x0000000000000000000000000000000000000000"}],"id":67}`
+	rr := backend.request(t, []byte(request), from)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, 1, builders[0].GetRequestCount(forkchoicePath))
+	require.Len(t, received.Params, 2)
+	require.Contains(t, string(received.Params[0]), "headBlockHash")
+	require.Equal(t, "null", string(received.Params[1]))
+	// the stripped builder answers with payloadId null, the beacon node gets the primary's payloadId
+	require.Equal(t, primaryResponse, rr.Body.String())
+
+	_, err = NewProxyService(ProxyServiceOpts{
+		Log:            testLog,
+		Builders:       urls,
+		BuilderTimeout: time.Second,
+		BuilderConfigs: map[string]*BuilderConfig{urls[0].String(): {StripPayloadAttributes: true}},
+	})
+	require.ErrorIs(t, err, errStripPrimaryBuilder)
+}
@@ -0,0 +1,340 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	minQueueBackoff = 10 * time.Millisecond
+	maxQueueBackoff = 10 * time.Second
+
+	// maxQueueAuthAttempts is the number of attempts of a request rejected as unauthorized, a JWT that expired
+	// in the queue is replaced by the one of the latest request, but a wrong JWT secret never succeeds
+	maxQueueAuthAttempts = 10
+)
+
+// queueItem is a request waiting to be delivered to a builder
+type queueItem struct {
+	Seq    uint64      `json:"seq"`
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// builderQueue delivers requests to a backup builder in the background, in the order they were received.
+// Requests are retried until the builder accepts them, so a slow or restarting builder doesn't miss any payloads.
+type builderQueue struct {
+	entry   *ProxyEntry
+	maxSize int
+	wal     *wal // optional, nil if the queue is only kept in memory
+	log     *logrus.Entry
+
+	mu         sync.Mutex
+	items      []*queueItem
+	walRecords []walRecord // records not written to the log yet, written by the log goroutine
+	nextSeq    uint64
+	auth       string // latest Authorization header, the JWT of queued requests may have expired on delivery
+	// requests not delivered to the builder because the queue was full or the builder rejected them, the
+	// builder has a gap in its chain then and needs to sync from the network
+	numRejected uint64
+	notify      chan struct{}
+	walNotify   chan struct{}
+	closed      chan struct{}
+	done        chan struct{}
+	walDone     chan struct{}
+}
+
+func newBuilderQueue(entry *ProxyEntry, maxSize int, walDir string, log *logrus.Entry) (*builderQueue, error) {
+	q := &builderQueue{
+		entry:     entry,
+		maxSize:   maxSize,
+		log:       log.WithField("url", entry.URL.String()),
+		nextSeq:   1,
+		notify:    make(chan struct{}, 1),
+		walNotify: make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+		walDone:   make(chan struct{}),
+	}
+
+	if walDir != "" {
+		wal, items, err := openWAL(filepath.Join(walDir, walFileName(entry)))
+		if err != nil {
+			return nil, err
+		}
+		q.wal = wal
+		q.items = items
+		if len(items) > 0 {
+			q.nextSeq = items[len(items)-1].Seq + 1
+			q.auth = items[len(items)-1].Header.Get("Authorization")
+			q.log.WithField("numRequests", len(items)).Info("restored queued requests for builder")
+		}
+	}
+
+	go q.run()
+	go q.runWAL()
+	return q, nil
+}
+
+func walFileName(entry *ProxyEntry) string {
+	return strings.NewReplacer(":", "_", "/", "_").Replace(entry.URL.Host+entry.URL.Path) + ".wal"
+}
+
+// enqueue adds the request to the queue. If the queue is full, the request is rejected and the builder is marked
+// as needing to resync, the requests already queued are still delivered in order.
+func (q *builderQueue) enqueue(req *http.Request, bodyBytes []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxSize > 0 && len(q.items) >= q.maxSize {
+		q.numRejected++
+		q.log.WithField("numRejected", q.numRejected).Error("builder queue is full, rejecting request, the builder has to sync the missing payloads from the network")
+		return
+	}
+
+	item := &queueItem{
+		Seq:    q.nextSeq,
+		Method: req.Method,
+		Path:   req.URL.RequestURI(),
+		Header: req.Header.Clone(),
+		Body:   bodyBytes,
+	}
+	q.nextSeq++
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		q.auth = auth
+	}
+
+	q.items = append(q.items, item)
+	q.writeWAL(walRecord{Item: item})
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// reject counts a request which is not delivered to the builder
+func (q *builderQueue) reject() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.numRejected++
+}
+
+// QueueStats contains the delivery statistics of an async builder
+type QueueStats struct {
+	URL         string `json:"url"`
+	QueueLength int    `json:"queue_length"`
+	Rejected    uint64 `json:"rejected"`     // requests not delivered, because the queue was full or the builder rejected them
+	NeedsResync bool   `json:"needs_resync"` // the builder missed requests and has to sync from the network
+}
+
+func (q *builderQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		URL:         statsURL(q.entry.URL),
+		QueueLength: len(q.items),
+		Rejected:    q.numRejected,
+		NeedsResync: q.numRejected > 0,
+	}
+}
+
+// len returns the number of requests which are not delivered yet
+func (q *builderQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *builderQueue) close() {
+	close(q.closed)
+	<-q.done
+	<-q.walDone
+	if q.wal != nil {
+		q.wal.close()
+	}
+}
+
+func (q *builderQueue) run() {
+	defer close(q.done)
+	for {
+		item, ok := q.next()
+		if !ok {
+			return
+		}
+		if !q.deliver(item) {
+			return
+		}
+
+		q.mu.Lock()
+		q.items = q.items[1:]
+		q.writeWAL(walRecord{Ack: item.Seq})
+		q.mu.Unlock()
+	}
+}
+
+// writeWAL hands the record to the log goroutine, so the beacon node's requests and the delivery don't wait
+// for the disk. q.mu must be held.
+func (q *builderQueue) writeWAL(record walRecord) {
+	if q.wal == nil {
+		return
+	}
+	q.walRecords = append(q.walRecords, record)
+	select {
+	case q.walNotify <- struct{}{}:
+	default:
+	}
+}
+
+// runWAL writes the records of the queue to the log in batches, the log is truncated whenever the queue is
+// drained so delivered requests don't accumulate
+func (q *builderQueue) runWAL() {
+	defer close(q.walDone)
+	if q.wal == nil {
+		return
+	}
+	for {
+		closed := false
+		select {
+		case <-q.walNotify:
+		case <-q.done:
+			closed = true
+		}
+
+		q.mu.Lock()
+		records := q.walRecords
+		q.walRecords = nil
+		drained := len(q.items) == 0
+		q.mu.Unlock()
+
+		if len(records) > 0 {
+			if err := q.wal.write(records); err != nil {
+				q.log.WithError(err).Error("failed to write to the builder queue log")
+			}
+		}
+		// all requests queued so far were delivered and their acks are written
+		if drained && len(records) > 0 {
+			if err := q.wal.truncate(); err != nil {
+				q.log.WithError(err).Error("failed to truncate the builder queue log")
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// next blocks until there is a request to deliver, returns false if the queue is closed
+func (q *builderQueue) next() (*queueItem, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.mu.Unlock()
+			return item, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-q.closed:
+			return nil, false
+		}
+	}
+}
+
+// deliver sends the request until it is accepted by the builder or dropped, returns false if the queue is closed
+func (q *builderQueue) deliver(item *queueItem) bool {
+	method := requestMethod(item.Body)
+	body, err := q.entry.encodeBody(method, item.Body)
+	if err != nil {
+		q.log.WithError(err).WithField("seq", item.Seq).Error("failed to encode queued request, dropping")
+		return true
+	}
+
+	timeout := q.entry.timeoutFor(method)
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := withTimeout(context.Background(), timeout)
+		req, err := http.NewRequestWithContext(ctx, item.Method, item.Path, nil)
+		if err != nil {
+			cancel()
+			q.log.WithError(err).WithField("seq", item.Seq).Error("invalid queued request, dropping")
+			return true
+		}
+		req.Header = item.Header.Clone()
+		q.mu.Lock()
+		if q.auth != "" {
+			req.Header.Set("Authorization", q.auth)
+		}
+		q.mu.Unlock()
+
+		resp, err := q.entry.Backend.Send(ctx, q.entry.buildRequest(req, body))
+		if err == nil {
+			io.Copy(io.Discard, resp.Body) //nolint:errcheck
+			resp.Body.Close()
+		}
+		cancel()
+
+		log := q.log.WithFields(logrus.Fields{
+			"seq":     item.Seq,
+			"attempt": attempt,
+		})
+		switch {
+		case err == nil && resp.StatusCode < http.StatusMultipleChoices:
+			log.Debug("delivered queued request to builder")
+			return true
+		case err == nil && !isQueueRetryableStatus(resp.StatusCode):
+			log.WithField("statusCode", resp.StatusCode).Error("builder rejected queued request, dropping")
+			q.reject()
+			return true
+		case err == nil && isAuthStatus(resp.StatusCode) && attempt >= maxQueueAuthAttempts:
+			log.WithField("statusCode", resp.StatusCode).Error("builder rejected queued request as unauthorized, dropping, check the JWT secret")
+			q.reject()
+			return true
+		case err != nil:
+			log = log.WithError(err)
+		default:
+			log = log.WithField("statusCode", resp.StatusCode)
+		}
+
+		backoff := q.backoff(attempt)
+		log.WithField("backoff", backoff.String()).Warn("failed to deliver queued request to builder, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-q.closed:
+			return false
+		}
+	}
+}
+
+// backoff returns the builder's retry backoff, bounded because queued requests are retried indefinitely
+func (q *builderQueue) backoff(attempt int) time.Duration {
+	backoff := q.entry.Retry.backoff(min(attempt, 16))
+	if backoff < minQueueBackoff {
+		return minQueueBackoff
+	}
+	if q.entry.Retry.MaxBackoff == 0 && backoff > maxQueueBackoff {
+		return maxQueueBackoff
+	}
+	return backoff
+}
+
+// isQueueRetryableStatus returns true for responses of a builder that is not available, or which rejected
+// an expired JWT that will be replaced by a newer one
+func isQueueRetryableStatus(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError || isAuthStatus(statusCode)
+}
+
+func isAuthStatus(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
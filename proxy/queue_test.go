@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// newPayloadRequestWithID returns the mock new payload request with the given JSON-RPC id
+func newPayloadRequestWithID(t *testing.T, id int) []byte {
+	var data engineapi.JSONRPCRequest
+	require.NoError(t, json.Unmarshal([]byte(mocks.NewPayloadRequest), &data))
+	data.ID = id
+	payload, err := json.Marshal(data)
+	require.NoError(t, err)
+	return payload
+}
+
+func TestBuilderQueue(t *testing.T) {
+	t.Run("async builder should receive requests in order after being unavailable", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		async := mocks.NewServer(t)
+		async.Response = []byte(mocks.NewPayloadResponseValid)
+		async.NumFailures = 3
+
+		entry := buildProxyEntry(getURLs(t, []*mocks.Server{async})[0], time.Second, nil)
+		queue, err := newBuilderQueue(&entry, 10, "", testLog)
+		require.NoError(t, err)
+		defer queue.close()
+		backend.proxyService.builderQueues = []*builderQueue{queue}
+
+		for id := 1; id <= 3; id++ {
+			rr := backend.request(t, newPayloadRequestWithID(t, id), from)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		require.Eventually(t, func() bool { return queue.len() == 0 }, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, []int{1, 1, 1, 1, 2, 3}, async.GetRequestIDs())
+		require.Equal(t, 3, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("queued requests should be restored from the log", func(t *testing.T) {
+		dir := t.TempDir()
+		async := mocks.NewServer(t)
+		async.Response = []byte(mocks.NewPayloadResponseValid)
+		async.NumFailures = 1000
+		entry := buildProxyEntry(getURLs(t, []*mocks.Server{async})[0], time.Second, nil)
+
+		queue, err := newBuilderQueue(&entry, 10, dir, testLog)
+		require.NoError(t, err)
+		for id := 1; id <= 2; id++ {
+			req, err := http.NewRequest(http.MethodPost, "/", nil)
+			require.NoError(t, err)
+			queue.enqueue(req, newPayloadRequestWithID(t, id))
+		}
+		queue.close()
+
+		async.NumFailures = 0
+		queue, err = newBuilderQueue(&entry, 10, dir, testLog)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return queue.len() == 0 }, 5*time.Second, 10*time.Millisecond)
+		queue.close()
+		require.Equal(t, []int{1, 2}, async.GetRequestIDs()[len(async.GetRequestIDs())-2:])
+
+		// the drained queue is not restored again
+		items, err := readWAL(filepath.Join(dir, walFileName(&entry)))
+		require.NoError(t, err)
+		require.Empty(t, items)
+	})
+
+	t.Run("full queue should reject requests and keep the queued ones", func(t *testing.T) {
+		async := mocks.NewServer(t)
+		async.Response = []byte(mocks.NewPayloadResponseValid)
+		async.ResponseDelay = 100 * time.Millisecond
+		entry := buildProxyEntry(getURLs(t, []*mocks.Server{async})[0], time.Second, nil)
+		queue, err := newBuilderQueue(&entry, 2, "", testLog)
+		require.NoError(t, err)
+		defer queue.close()
+
+		for id := 1; id <= 3; id++ {
+			req, err := http.NewRequest(http.MethodPost, "/", nil)
+			require.NoError(t, err)
+			queue.enqueue(req, newPayloadRequestWithID(t, id))
+		}
+		require.Equal(t, QueueStats{URL: async.Server.URL, QueueLength: 2, Rejected: 1, NeedsResync: true}, queue.stats())
+
+		require.Eventually(t, func() bool { return queue.len() == 0 }, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, []int{1, 2}, async.GetRequestIDs())
+	})
+
+	t.Run("unauthorized requests should be dropped after a number of attempts", func(t *testing.T) {
+		var attempts atomic.Int32
+		entry := buildProxyEntry(getURLs(t, createMockServers(t, 1))[0], time.Second, nil)
+		entry.Backend = HandlerBackend{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		})}
+		queue, err := newBuilderQueue(&entry, 10, "", testLog)
+		require.NoError(t, err)
+		defer queue.close()
+
+		req, err := http.NewRequest(http.MethodPost, "/", nil)
+		require.NoError(t, err)
+		queue.enqueue(req, newPayloadRequestWithID(t, 1))
+
+		require.Eventually(t, func() bool { return queue.len() == 0 }, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, int32(maxQueueAuthAttempts), attempts.Load())
+		require.True(t, queue.stats().NeedsResync)
+	})
+
+	t.Run("first builder can not be async", func(t *testing.T) {
+		builders := getURLs(t, createMockServers(t, 2))
+		_, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			Builders:       builders,
+			BuilderConfigs: map[string]*BuilderConfig{builders[0].String(): {Async: true}},
+		})
+		require.ErrorIs(t, err, errAsyncPrimaryBuilder)
+	})
+}
+
+func TestWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "builder.wal")
+
+	w, items, err := openWAL(path)
+	require.NoError(t, err)
+	require.Empty(t, items)
+
+	var records []walRecord
+	for seq := uint64(1); seq <= 3; seq++ {
+		records = append(records, walRecord{Item: &queueItem{Seq: seq, Method: http.MethodPost, Path: "/", Body: []byte(mocks.NewPayloadRequest)}})
+	}
+	require.NoError(t, w.write(records))
+	require.NoError(t, w.write([]walRecord{{Ack: 1}}))
+	require.NoError(t, w.close())
+
+	w, items, err = openWAL(path)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, uint64(2), items[0].Seq)
+	require.Equal(t, uint64(3), items[1].Seq)
+	require.Equal(t, []byte(mocks.NewPayloadRequest), items[0].Body)
+
+	require.NoError(t, w.truncate())
+	require.NoError(t, w.close())
+
+	_, items, err = openWAL(path)
+	require.NoError(t, err)
+	require.Empty(t, items)
+}
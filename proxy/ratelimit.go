@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTimeout is the time after which the token bucket of a source that stopped sending requests is removed
+var limiterIdleTimeout = 10 * time.Minute
+
+type sourceLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter is a token bucket rate limit per request source
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	sources   map[string]*sourceLimiter
+	lastPrune time.Time
+}
+
+// newRateLimiter returns a limiter allowing limit requests per second per source, nil if limit is 0
+func newRateLimiter(limit float64, burst int) *rateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		limit:     rate.Limit(limit),
+		burst:     max(burst, 1),
+		sources:   make(map[string]*sourceLimiter),
+		lastPrune: time.Now(),
+	}
+}
+
+func (r *rateLimiter) allow(source string) bool {
+	if r == nil {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastPrune) > limiterIdleTimeout {
+		for key, entry := range r.sources {
+			if now.Sub(entry.lastSeen) > limiterIdleTimeout {
+				delete(r.sources, key)
+			}
+		}
+		r.lastPrune = now
+	}
+
+	entry, ok := r.sources[source]
+	if !ok {
+		entry = &sourceLimiter{limiter: rate.NewLimiter(r.limit, r.burst)}
+		r.sources[source] = entry
+	}
+	entry.lastSeen = now
+	return entry.limiter.AllowN(now, 1)
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/engineapi"
+)
+
+var errResponseTooLarge = errors.New("builder response too large")
+
+// statusPrefixSize is the size of the beginning of a streamed response which is kept to read the payload status
+const statusPrefixSize = 16 * 1024
+
+// limitedReader returns errResponseTooLarge once more than max bytes are read
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+// newLimitedReader limits the reader to max bytes, no limit if max is 0
+func newLimitedReader(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, max: max}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, errResponseTooLarge
+	}
+	return n, err
+}
+
+// prefixWriter keeps the first bytes written to it and discards the rest
+type prefixWriter struct {
+	buf   []byte
+	limit int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if n := w.limit - len(w.buf); n > 0 {
+		w.buf = append(w.buf, p[:min(n, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// readResponseStatus reads the payload status of a newPayload or forkchoiceUpdated response with the given
+// Content-Encoding. The body may be cut off after the status.
+func readResponseStatus(method, encoding string, body []byte) (string, error) {
+	if !strings.HasPrefix(method, engineapi.NewPayload) && !strings.HasPrefix(method, engineapi.ForkchoiceUpdated) {
+		return "", nil // not interested in other engine api calls
+	}
+
+	reader, err := compression.DecodeReader(encoding, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	return engineapi.ExtractStatus(method, reader)
+}
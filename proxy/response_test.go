@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/compression"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadResponseStatus(t *testing.T) {
+	for _, encoding := range []string{"", compression.Gzip, compression.Zstd} {
+		body, err := compression.Encode(encoding, []byte(mocks.NewPayloadResponseValid))
+		require.NoError(t, err)
+
+		status, err := readResponseStatus(newPayloadPath, encoding, body)
+		require.NoError(t, err, encoding)
+		require.Equal(t, "VALID", status, encoding)
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	data, err := io.ReadAll(newLimitedReader(strings.NewReader("0123456789"), 10))
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(data))
+
+	_, err = io.ReadAll(newLimitedReader(strings.NewReader("0123456789"), 9))
+	require.ErrorIs(t, err, errResponseTooLarge)
+
+	data, err = io.ReadAll(newLimitedReader(strings.NewReader("0123456789"), 0))
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(data))
+}
+
+func TestResponseSize(t *testing.T) {
+	t.Run("should fall back to other builders if the response is too large", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].MaxResponseSize = 64
+		backend.builders[0].Response = []byte(mocks.NewPayloadResponseSyncing)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, mocks.NewPayloadResponseValid, rr.Body.String())
+	})
+
+	t.Run("should fall back to other builders if a response without content length is too large", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].MaxResponseSize = 1 << 10
+		// too large to be buffered by the builder's server, so it is sent chunked
+		backend.builders[0].Response = bytes.Repeat([]byte(" "), 8<<10)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, mocks.NewPayloadResponseValid, rr.Body.String())
+	})
+
+	t.Run("should abort the response if the limit is exceeded while streaming", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].MaxResponseSize = 64 << 10
+		backend.builders[0].Response = bytes.Repeat([]byte(" "), 128<<10)
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		resp, err := http.Post(server.URL, "application/json", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		require.Error(t, err)
+	})
+
+	t.Run("should forward aborted responses to the proxies", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 1, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].MaxResponseSize = 64 << 10
+		backend.builders[0].Response = bytes.Repeat([]byte(" "), 128<<10)
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		resp, err := http.Post(server.URL, "application/json", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		require.Error(t, err)
+		require.Eventually(t, func() bool { return backend.proxies[0].GetRequestCount(newPayloadPath) == 1 }, time.Second, 5*time.Millisecond)
+	})
+}
+
+func TestStreaming(t *testing.T) {
+	t.Run("should stream the primary response before the other builders responded", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.builders[1].ResponseDelay = 500 * time.Millisecond
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		start := time.Now()
+		resp, err := http.Post(server.URL, "application/json", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, mocks.NewPayloadResponseValid, string(body))
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("should stream large responses", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		response := bytes.Repeat([]byte("0"), 4<<20)
+		backend.builders[0].Response = response
+		backend.builders[1].Response = response
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, len(response), rr.Body.Len())
+	})
+
+	t.Run("should decompress streamed responses the beacon node doesn't accept", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.builders[0].ResponseEncoding = compression.Zstd
+		backend.proxyService.builderEntries[0].AcceptEncoding = compression.Zstd
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "", rr.Header().Get("Content-Encoding"))
+		require.Equal(t, mocks.NewPayloadResponseValid, rr.Body.String())
+	})
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryConfig is the retry policy for requests to a builder
+type RetryConfig struct {
+	MaxAttempts    int      `json:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+}
+
+// withDefaults returns the retry config with unset values taken from defaults
+func (c RetryConfig) withDefaults(defaults RetryConfig) RetryConfig {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = defaults.MaxAttempts
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = defaults.InitialBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaults.MaxBackoff
+	}
+	return c
+}
+
+// backoff returns the time to wait after the given (1-based) failed attempt
+func (c RetryConfig) backoff(attempt int) time.Duration {
+	backoff := c.InitialBackoff.Duration()
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if c.MaxBackoff > 0 && backoff >= c.MaxBackoff.Duration() {
+			return c.MaxBackoff.Duration()
+		}
+	}
+	return backoff
+}
+
+// isRetryable returns true if the request failed because of a network error or an unavailable builder
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// sendBuilderRequest sends the request to the builder and retries transient failures according to
+// the builder's retry policy. The builder's timeout for the method is the deadline for all attempts
+// including reading the response body, retries are only started if they can finish before it.
+func (p *ProxyService) sendBuilderRequest(req *http.Request, entry *ProxyEntry, method string, bodyBytes []byte) (resp *http.Response, err error) {
+	timeout := entry.timeoutFor(method)
+	ctx, span := p.tracer.Start(req.Context(), "builder request", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("builder.url", entry.URL.String()), attribute.String("builder.timeout", timeout.String())))
+	attempt := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("builder.attempts", attempt))
+		if resp != nil {
+			endSpan(span, resp.StatusCode, err)
+		} else {
+			endSpan(span, 0, err)
+		}
+	}()
+
+	// unless the client cancel mode ties it to the beacon node's request, only the timeout ends the request
+	if !p.cancelWithClient(entry, method) {
+		ctx = context.WithoutCancel(ctx)
+	}
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer func() {
+		if err != nil {
+			cancel()
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = fmt.Errorf("%w after %s", errBuilderTimeout, timeout)
+			}
+			return
+		}
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	}()
+	deadline, hasDeadline := ctx.Deadline()
+
+	bodyBytes, err = entry.encodeBody(method, bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt = 1; ; attempt++ {
+		builderReq := entry.buildRequest(req, bodyBytes)
+		injectTraceContext(ctx, builderReq.Header)
+		resp, err = entry.Backend.Send(ctx, builderReq)
+		if attempt >= entry.Retry.MaxAttempts || !isRetryable(resp, err) {
+			return resp, err
+		}
+
+		backoff := entry.Retry.backoff(attempt)
+		if hasDeadline && time.Now().Add(backoff).After(deadline) {
+			return resp, err
+		}
+
+		log := p.log.WithFields(logrus.Fields{
+			"url":     entry.URL.String(),
+			"attempt": attempt,
+			"backoff": backoff.String(),
+		})
+		if err != nil {
+			log = log.WithError(err)
+		} else {
+			log = log.WithField("statusCode", resp.StatusCode)
+			io.Copy(io.Discard, resp.Body) //nolint:errcheck
+			resp.Body.Close()
+		}
+		log.Warn("request to builder failed, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	retry := RetryConfig{
+		MaxAttempts:    5,
+		InitialBackoff: Duration(100 * time.Millisecond),
+		MaxBackoff:     Duration(300 * time.Millisecond),
+	}
+
+	require.Equal(t, 100*time.Millisecond, retry.backoff(1))
+	require.Equal(t, 200*time.Millisecond, retry.backoff(2))
+	require.Equal(t, 300*time.Millisecond, retry.backoff(3))
+	require.Equal(t, 300*time.Millisecond, retry.backoff(4))
+}
+
+func TestRetry(t *testing.T) {
+	retry := RetryConfig{MaxAttempts: 3, InitialBackoff: Duration(10 * time.Millisecond)}
+
+	t.Run("should retry builder on unavailable response", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		for _, entry := range backend.proxyService.builderEntries {
+			entry.Retry = retry
+		}
+
+		backend.builders[0].NumFailures = 2
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 3, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(newPayloadPath))
+		require.Equal(t, mocks.NewPayloadResponseValid, rr.Body.String())
+	})
+
+	t.Run("should give up after max attempts", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].Retry = retry
+
+		backend.builders[0].NumFailures = 5
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+		require.Equal(t, 3, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should not retry if backoff exceeds the builder timeout", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, 50*time.Millisecond, time.Second)
+		backend.proxyService.builderEntries[0].Retry = RetryConfig{MaxAttempts: 3, InitialBackoff: Duration(time.Second)}
+
+		backend.builders[0].NumFailures = 1
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should stop the backoff when the request is cancelled", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, 5*time.Second, time.Second)
+		backend.proxyService.clientCancel = ClientCancelAll
+		entry := backend.proxyService.builderEntries[0]
+		entry.Retry = RetryConfig{MaxAttempts: 3, InitialBackoff: Duration(time.Second)}
+		backend.builders[0].NumFailures = 1
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = backend.proxyService.sendBuilderRequest(req, entry, newPayloadPath, []byte(mocks.NewPayloadRequest))
+		require.ErrorIs(t, err, context.Canceled)
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+}
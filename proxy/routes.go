@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+var errNoRoutedBuilders = errors.New("no builders for method")
+
+// RouteConfig sends the methods matching a pattern only to some builders. Builders are selected by url and by
+// group, all builders if neither is set, and the excluded builders are removed from them.
+type RouteConfig struct {
+	Method   string   `json:"method"` // pattern of the method, e.g. engine_newPayload*
+	Builders []string `json:"builders,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Exclude  []string `json:"exclude,omitempty"`
+}
+
+func (c *RouteConfig) validate() error {
+	if c.Method == "" {
+		return errors.New("route has no method")
+	}
+	if _, err := path.Match(c.Method, ""); err != nil {
+		return fmt.Errorf("invalid method pattern %s in route: %w", c.Method, err)
+	}
+	return nil
+}
+
+// route is a RouteConfig resolved to the urls of its builders
+type route struct {
+	pattern  string
+	builders map[string]bool
+}
+
+// buildRoutes resolves the builders of the routes from all builder entries, including async and shadow builders
+func buildRoutes(configs []RouteConfig, entries []*ProxyEntry) ([]*route, error) {
+	urls := make(map[string]bool, len(entries))
+	groups := make(map[string]bool)
+	for _, entry := range entries {
+		urls[entry.URL.String()] = true
+		groups[entry.Group] = true
+	}
+	resolve := func(rawURLs []string) (map[string]bool, error) {
+		resolved := make(map[string]bool, len(rawURLs))
+		for _, rawURL := range rawURLs {
+			url, err := ParseURL(rawURL)
+			if err != nil {
+				return nil, err
+			}
+			if !urls[url.String()] {
+				return nil, fmt.Errorf("unknown builder %s", rawURL)
+			}
+			resolved[url.String()] = true
+		}
+		return resolved, nil
+	}
+
+	routes := make([]*route, 0, len(configs))
+	for _, config := range configs {
+		if err := config.validate(); err != nil {
+			return nil, err
+		}
+		builders, err := resolve(config.Builders)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", config.Method, err)
+		}
+		excluded, err := resolve(config.Exclude)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", config.Method, err)
+		}
+		selected := make(map[string]bool, len(config.Groups))
+		for _, group := range config.Groups {
+			if !groups[group] {
+				return nil, fmt.Errorf("route %s: unknown group %s", config.Method, group)
+			}
+			selected[group] = true
+		}
+
+		r := &route{pattern: config.Method, builders: make(map[string]bool)}
+		for _, entry := range entries {
+			url := entry.URL.String()
+			all := len(config.Builders) == 0 && len(config.Groups) == 0
+			if (all || builders[url] || selected[entry.Group]) && !excluded[url] {
+				r.builders[url] = true
+			}
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// routedEntries returns the builders the method is routed to, in the order of builderEntries with the preferred
+// group first. The first of them is the primary builder of the method.
+func (p *ProxyService) routedEntries(method string) []*ProxyEntry {
+	var entries []*ProxyEntry
+	for _, entry := range p.builderEntries {
+		if p.isRouted(method, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// isRouted returns true if the method is sent to the entry. The first route matching the method applies, methods
+// without a matching route are sent to all builders.
+func (p *ProxyService) isRouted(method string, entry *ProxyEntry) bool {
+	for _, r := range p.routes {
+		if matched, _ := path.Match(r.pattern, method); matched {
+			return r.builders[entry.URL.String()]
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// withRoutes puts the first two of three builders in the building group and the third in the archive group,
+// and sets the routes created from the builder urls
+func withRoutes(routes func(urls []string) []RouteConfig) func(opts *ProxyServiceOpts) {
+	return func(opts *ProxyServiceOpts) {
+		urls := []string{opts.Builders[0].String(), opts.Builders[1].String(), opts.Builders[2].String()}
+		opts.BuilderConfigs = map[string]*BuilderConfig{
+			urls[0]: {Group: "building"},
+			urls[1]: {Group: "building"},
+			urls[2]: {Group: "archive"},
+		}
+		opts.Routes = routes(urls)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	t.Run("should only send methods to the builders they are routed to", func(t *testing.T) {
+		backend := newTestBackend(t, 3, 0, time.Second, time.Second, withRoutes(func(urls []string) []RouteConfig {
+			return []RouteConfig{{Method: "engine_forkchoiceUpdated*", Groups: []string{"building"}, Exclude: []string{urls[1]}}}
+		}))
+		for _, builder := range backend.builders {
+			builder.Response = []byte(mocks.ForkchoiceResponse)
+		}
+
+		rr := backend.request(t, []byte(mocks.ForkchoiceRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, []int{1, 0, 0}, []int{
+			backend.builders[0].GetRequestCount(forkchoicePath),
+			backend.builders[1].GetRequestCount(forkchoicePath),
+			backend.builders[2].GetRequestCount(forkchoicePath),
+		})
+
+		rr = backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		for _, builder := range backend.builders {
+			require.Equal(t, 1, builder.GetRequestCount(newPayloadPath))
+		}
+	})
+
+	t.Run("should respond with a routed builder if the primary builder is not routed", func(t *testing.T) {
+		backend := newTestBackend(t, 3, 0, time.Second, time.Second, withRoutes(func(urls []string) []RouteConfig {
+			return []RouteConfig{{Method: "engine_newPayload*", Builders: []string{urls[2]}}}
+		}))
+		backend.builders[2].Response = []byte(mocks.NewPayloadResponseSyncing)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, mocks.NewPayloadResponseSyncing, rr.Body.String())
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should respond with the first routed builder if the primary builder is excluded", func(t *testing.T) {
+		backend := newTestBackend(t, 3, 0, time.Second, time.Second, func(opts *ProxyServiceOpts) {
+			opts.Routes = []RouteConfig{{Method: "engine_forkchoiceUpdated*", Exclude: []string{opts.Builders[0].String()}}}
+		})
+		primaryResponse := strings.Replace(mocks.ForkchoiceResponse, `"payloadId": null`, `"payloadId": "0x0000000000000001"`, 1)
+		backend.builders[1].Response = []byte(primaryResponse)
+		backend.builders[1].ResponseDelay = 50 * time.Millisecond
+		backend.builders[2].Response = []byte(mocks.ForkchoiceResponse)
+
+		rr := backend.request(t, []byte(mocks.ForkchoiceRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, primaryResponse, rr.Body.String())
+		require.Equal(t, 0, backend.builders[0].GetRequestCount(forkchoicePath))
+	})
+
+	t.Run("should fail if no builder is routed", func(t *testing.T) {
+		backend := newTestBackend(t, 3, 0, time.Second, time.Second, withRoutes(func(urls []string) []RouteConfig {
+			return []RouteConfig{{Method: "engine_newPayloadV1", Exclude: urls}, {Method: "engine_newPayload*"}}
+		}))
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+		for _, builder := range backend.builders {
+			require.Equal(t, 0, builder.GetRequestCount(newPayloadPath))
+		}
+	})
+
+	t.Run("should reject invalid routes", func(t *testing.T) {
+		for _, routes := range [][]RouteConfig{
+			{{Method: "engine_newPayload*", Groups: []string{"unknown"}}},
+			{{Method: "engine_newPayload*", Exclude: []string{"localhost:1"}}},
+			{{Method: "engine_[newPayload"}},
+		} {
+			opts := ProxyServiceOpts{Log: testLog, Builders: getURLs(t, createMockServers(t, 3)), BuilderTimeout: time.Second}
+			withRoutes(func([]string) []RouteConfig { return routes })(&opts)
+			_, err := NewProxyService(opts)
+			require.Error(t, err)
+		}
+	})
+}
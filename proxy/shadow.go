@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/sirupsen/logrus"
+)
+
+// shadowBuilder gets every request like the other builders, but its responses are only compared with the
+// response sent to the beacon node and never sent to it, even if all other builders failed
+type shadowBuilder struct {
+	entry *ProxyEntry
+
+	numRequests   atomic.Uint64
+	numMatches    atomic.Uint64
+	numMismatches atomic.Uint64
+	numFailures   atomic.Uint64
+}
+
+// shadowResult is the outcome of a request to a shadow builder
+type shadowResult struct {
+	status string
+	err    error
+}
+
+// ShadowStats contains the comparison statistics of a shadow builder
+type ShadowStats struct {
+	URL        string `json:"url"`
+	Requests   uint64 `json:"requests"`
+	Matches    uint64 `json:"matches"`    // responses with the same payload status as the response to the beacon node
+	Mismatches uint64 `json:"mismatches"` // responses with a different payload status
+	Failures   uint64 `json:"failures"`   // failed requests
+}
+
+func (s *shadowBuilder) stats() ShadowStats {
+	return ShadowStats{
+		URL:        statsURL(s.entry.URL),
+		Requests:   s.numRequests.Load(),
+		Matches:    s.numMatches.Load(),
+		Mismatches: s.numMismatches.Load(),
+		Failures:   s.numFailures.Load(),
+	}
+}
+
+// callShadowBuilders sends the request to the shadow builders and returns a function comparing their responses
+// with the response sent to the beacon node. The beacon node's response doesn't wait for the shadow builders.
+func (p *ProxyService) callShadowBuilders(req *http.Request, requestJSON engineapi.JSONRPCRequest, bodyBytes []byte) func(BuilderResponse) {
+	if len(p.shadowBuilders) == 0 {
+		return func(BuilderResponse) {}
+	}
+
+	results := make([]chan shadowResult, len(p.shadowBuilders))
+	for i, shadow := range p.shadowBuilders {
+		if !p.isRouted(requestJSON.Method, shadow.entry) {
+			continue
+		}
+		if !p.addShadowTask() {
+			break
+		}
+		results[i] = make(chan shadowResult, 1)
+		go func(shadow *shadowBuilder, result chan<- shadowResult) {
+			defer p.shadowWG.Done()
+			result <- p.sendShadowRequest(req, shadow.entry, requestJSON.Method, bodyBytes)
+		}(shadow, results[i])
+	}
+
+	return func(response BuilderResponse) {
+		if !p.addShadowTask() {
+			return
+		}
+		go func() {
+			defer p.shadowWG.Done()
+			for i, shadow := range p.shadowBuilders {
+				if results[i] == nil {
+					continue
+				}
+				p.recordShadowResult(shadow, requestJSON, response, <-results[i])
+			}
+		}()
+	}
+}
+
+// addShadowTask adds a task to the shadow wait group, false if the service is closed and no task may be started
+func (p *ProxyService) addShadowTask() bool {
+	p.shadowMu.Lock()
+	defer p.shadowMu.Unlock()
+	if p.shadowClosed {
+		return false
+	}
+	p.shadowWG.Add(1)
+	return true
+}
+
+// sendShadowRequest sends the request to a shadow builder and reads the payload status of the response
+func (p *ProxyService) sendShadowRequest(req *http.Request, entry *ProxyEntry, method string, bodyBytes []byte) shadowResult {
+	resp, err := p.sendBuilderRequest(req, entry, method, bodyBytes)
+	if err != nil {
+		return shadowResult{err: err}
+	}
+	defer resp.Body.Close()
+
+	prefix := &prefixWriter{limit: statusPrefixSize}
+	if _, err := io.Copy(prefix, newLimitedReader(resp.Body, entry.MaxResponseSize)); err != nil {
+		return shadowResult{err: err}
+	}
+	return shadowResult{status: p.readStatus(method, resp.Header.Get("Content-Encoding"), prefix.buf, entry.URL)}
+}
+
+// recordShadowResult counts and logs the response of a shadow builder compared to the primary response
+func (p *ProxyService) recordShadowResult(shadow *shadowBuilder, requestJSON engineapi.JSONRPCRequest, primary BuilderResponse, result shadowResult) {
+	shadow.numRequests.Add(1)
+	log := p.log.WithFields(logrus.Fields{
+		"method":    requestJSON.Method,
+		"id":        requestJSON.ID,
+		"shadowUrl": shadow.entry.URL.String(),
+	})
+	if result.err != nil {
+		shadow.numFailures.Add(1)
+		log.WithError(result.err).Warn("error sending request to shadow builder")
+		return
+	}
+	// there is nothing to compare with if all builders failed or the method has no payload status
+	if primary.URL == nil || primary.Status == "" || !engineapi.IsEngineRequest(requestJSON.Method) {
+		return
+	}
+
+	if result.status == primary.Status {
+		shadow.numMatches.Add(1)
+		return
+	}
+	shadow.numMismatches.Add(1)
+	log.WithFields(logrus.Fields{
+		"primaryStatus": primary.Status,
+		"shadowStatus":  result.status,
+		"primaryUrl":    primary.URL.String(),
+	}).Info("found difference in shadow builder response")
+}
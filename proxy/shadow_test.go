@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// withShadow makes the last builder a shadow builder
+func withShadow(opts *ProxyServiceOpts) {
+	opts.BuilderConfigs = map[string]*BuilderConfig{opts.Builders[len(opts.Builders)-1].String(): {Shadow: true}}
+}
+
+func TestShadowBuilder(t *testing.T) {
+	t.Run("should compare the responses of shadow builders", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second, withShadow)
+		backend.builders[1].Response = []byte(mocks.NewPayloadResponseSyncing)
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, mocks.NewPayloadResponseValid, rr.Body.String())
+
+		// the shadow builder's response is compared after the response to the beacon node
+		require.Eventually(t, func() bool { return backend.proxyService.Stats().Shadows[0].Requests == 1 }, time.Second, 5*time.Millisecond)
+		backend.builders[1].Response = []byte(mocks.NewPayloadResponseValid)
+		rr = backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		backend.proxyService.Close()
+		require.Equal(t, 2, backend.builders[1].GetRequestCount(newPayloadPath))
+		require.Equal(t, []ShadowStats{{URL: backend.builders[1].Server.URL, Requests: 2, Matches: 1, Mismatches: 1}}, backend.proxyService.Stats().Shadows)
+	})
+
+	t.Run("should not use the shadow builder if all other builders fail", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second, withShadow)
+		backend.builders[0].Server.Close()
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+
+		backend.proxyService.Close()
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(newPayloadPath))
+		require.Equal(t, uint64(1), backend.proxyService.Stats().Shadows[0].Requests)
+	})
+
+	t.Run("should not wait for shadow builders", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second, withShadow)
+		backend.builders[1].ResponseDelay = 500 * time.Millisecond
+
+		start := time.Now()
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+
+		backend.proxyService.Close()
+		require.Equal(t, uint64(1), backend.proxyService.Stats().Shadows[0].Matches)
+	})
+
+	t.Run("should not call shadow builders after closing", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second, withShadow)
+		backend.proxyService.Close()
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 0, backend.builders[1].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("first builder can not be a shadow", func(t *testing.T) {
+		builders := getURLs(t, createMockServers(t, 2))
+		_, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			Builders:       builders,
+			BuilderTimeout: time.Second,
+			BuilderConfigs: map[string]*BuilderConfig{builders[0].String(): {Shadow: true}},
+		})
+		require.ErrorIs(t, err, errShadowPrimaryBuilder)
+		require.ErrorContains(t, err, builders[0].String())
+		require.ErrorContains(t, err, DefaultGroup)
+	})
+
+	t.Run("groups can be made only of shadow builders", func(t *testing.T) {
+		backend := newTestBackend(t, 3, 0, time.Second, time.Second, func(opts *ProxyServiceOpts) {
+			opts.BuilderConfigs = map[string]*BuilderConfig{
+				opts.Builders[1].String(): {Group: "trial", Shadow: true},
+				opts.Builders[2].String(): {Group: "trial", Shadow: true},
+			}
+		})
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		backend.proxyService.Close()
+		require.Len(t, backend.proxyService.Stats().Shadows, 2)
+		require.Len(t, backend.proxyService.Stats().Groups, 1)
+	})
+
+	t.Run("should require a builder which is not a shadow", func(t *testing.T) {
+		builders := getURLs(t, createMockServers(t, 1))
+		_, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			Builders:       builders,
+			BuilderTimeout: time.Second,
+			BuilderConfigs: map[string]*BuilderConfig{builders[0].String(): {Shadow: true}},
+		})
+		require.ErrorIs(t, err, errNoBuilders)
+	})
+}
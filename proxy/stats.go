@@ -0,0 +1,58 @@
+package proxy
+
+import "net/url"
+
+// Stats contains the statistics of the proxy service, served as JSON on GET /stats
+type Stats struct {
+	Proxies           []ProxyStats  `json:"proxies"`
+	Queues            []QueueStats  `json:"queues"`
+	Shadows           []ShadowStats `json:"shadows"`
+	Groups            []GroupStats  `json:"groups"`
+	RejectedACL       uint64        `json:"rejected_acl"`        // requests rejected by the access control lists
+	RejectedRateLimit uint64        `json:"rejected_rate_limit"` // requests rejected by the rate limit
+}
+
+// ProxyStats contains the forwarding statistics of a downstream proxy
+type ProxyStats struct {
+	URL          string  `json:"url"`
+	Success      uint64  `json:"success"`
+	Failure      uint64  `json:"failure"`
+	Dropped      uint64  `json:"dropped"`
+	QueueLength  int     `json:"queue_length"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// statsURL returns the url without user info, so credentials of builders and proxies aren't served in the stats
+func statsURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	redacted := *u
+	redacted.User = nil
+	return redacted.String()
+}
+
+// Stats returns a snapshot of the statistics of the proxy service
+func (p *ProxyService) Stats() Stats {
+	stats := Stats{
+		Proxies:           make([]ProxyStats, 0, len(p.proxyForwarders)),
+		Queues:            make([]QueueStats, 0, len(p.builderQueues)),
+		Shadows:           make([]ShadowStats, 0, len(p.shadowBuilders)),
+		Groups:            make([]GroupStats, 0, len(p.groups)),
+		RejectedACL:       p.numRejectedACL.Load(),
+		RejectedRateLimit: p.numRejectedRateLimit.Load(),
+	}
+	for _, forwarder := range p.proxyForwarders {
+		stats.Proxies = append(stats.Proxies, forwarder.stats())
+	}
+	for _, queue := range p.builderQueues {
+		stats.Queues = append(stats.Queues, queue.stats())
+	}
+	for _, group := range p.groups {
+		stats.Groups = append(stats.Groups, group.stats())
+	}
+	for _, shadow := range p.shadowBuilders {
+		stats.Shadows = append(stats.Shadows, shadow.stats())
+	}
+	return stats
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errBuilderTimeout = errors.New("builder request timed out")
+
+// ParseMethodTimeouts parses a comma-separated list of method=milliseconds, e.g. engine_newPayload=8000
+func ParseMethodTimeouts(list string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		method, ms, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid method timeout %q, expected method=milliseconds", entry)
+		}
+		timeoutMs, err := strconv.Atoi(strings.TrimSpace(ms))
+		if err != nil || timeoutMs <= 0 {
+			return nil, fmt.Errorf("invalid method timeout %q, expected method=milliseconds", entry)
+		}
+		timeouts[strings.TrimSpace(method)] = time.Duration(timeoutMs) * time.Millisecond
+	}
+	return timeouts, nil
+}
+
+// timeoutFor returns the timeout of a request to the entry. Methods are matched by prefix, the longest match
+// wins, so engine_newPayload applies to all versions unless a version has its own timeout.
+func (e *ProxyEntry) timeoutFor(method string) time.Duration {
+	timeout, matched := e.Timeout, ""
+	for prefix, methodTimeout := range e.MethodTimeouts {
+		if strings.HasPrefix(method, prefix) && len(prefix) > len(matched) {
+			timeout, matched = methodTimeout, prefix
+		}
+	}
+	return timeout
+}
+
+// withTimeout returns a context with the timeout, or without deadline if the timeout is 0
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// cancelOnClose cancels the context of a request once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// requestMethod returns the JSON-RPC method of a request body
+func requestMethod(body []byte) string {
+	var msg struct {
+		Method string `json:"method"`
+	}
+	json.Unmarshal(body, &msg) //nolint:errcheck
+	return msg.Method
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMethodTimeouts(t *testing.T) {
+	timeouts, err := ParseMethodTimeouts("engine_newPayload=8000, engine_forkchoiceUpdated=2000")
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{
+		"engine_newPayload":        8 * time.Second,
+		"engine_forkchoiceUpdated": 2 * time.Second,
+	}, timeouts)
+
+	timeouts, err = ParseMethodTimeouts("")
+	require.NoError(t, err)
+	require.Empty(t, timeouts)
+
+	_, err = ParseMethodTimeouts("engine_newPayload")
+	require.Error(t, err)
+	_, err = ParseMethodTimeouts("engine_newPayload=0")
+	require.Error(t, err)
+	_, err = ParseMethodTimeouts("engine_newPayload=1s")
+	require.Error(t, err)
+}
+
+func TestTimeoutFor(t *testing.T) {
+	entry := ProxyEntry{
+		Timeout: time.Second,
+		MethodTimeouts: map[string]time.Duration{
+			"engine_newPayload":   8 * time.Second,
+			"engine_newPayloadV3": 10 * time.Second,
+		},
+	}
+
+	require.Equal(t, 8*time.Second, entry.timeoutFor("engine_newPayloadV2"))
+	require.Equal(t, 10*time.Second, entry.timeoutFor("engine_newPayloadV3"))
+	require.Equal(t, time.Second, entry.timeoutFor("engine_forkchoiceUpdatedV3"))
+}
+
+func TestBuilderConfigTimeouts(t *testing.T) {
+	defaults := map[string]time.Duration{"engine_newPayload": 8 * time.Second}
+
+	config := BuilderConfig{}
+	timeout, methodTimeouts := config.timeouts(time.Second, defaults)
+	require.Equal(t, time.Second, timeout)
+	require.Equal(t, defaults, methodTimeouts)
+
+	config = BuilderConfig{MethodTimeouts: map[string]Duration{"engine_forkchoiceUpdated": Duration(500 * time.Millisecond)}}
+	timeout, methodTimeouts = config.timeouts(time.Second, defaults)
+	require.Equal(t, time.Second, timeout)
+	require.Equal(t, map[string]time.Duration{
+		"engine_newPayload":        8 * time.Second,
+		"engine_forkchoiceUpdated": 500 * time.Millisecond,
+	}, methodTimeouts)
+
+	// the builder's timeout replaces the default method timeouts
+	config = BuilderConfig{Timeout: Duration(3 * time.Second)}
+	timeout, methodTimeouts = config.timeouts(time.Second, defaults)
+	require.Equal(t, 3*time.Second, timeout)
+	require.Empty(t, methodTimeouts)
+}
+
+func TestTimeouts(t *testing.T) {
+	t.Run("should enforce method timeouts on builder responses", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].MethodTimeouts = map[string]time.Duration{
+			"engine_forkchoiceUpdated": 50 * time.Millisecond,
+		}
+		backend.builders[0].ResponseDelay = 200 * time.Millisecond
+
+		rr := backend.request(t, []byte(mocks.ForkchoiceRequest), from)
+		require.Equal(t, http.StatusGatewayTimeout, rr.Code, rr.Body.String())
+		require.Contains(t, rr.Body.String(), errBuilderTimeout.Error())
+
+		rr = backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+
+	t.Run("should respond with other builders if one times out", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].Timeout = 50 * time.Millisecond
+		backend.builders[0].ResponseDelay = 200 * time.Millisecond
+
+		start := time.Now()
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Less(t, time.Since(start), 200*time.Millisecond)
+	})
+
+	t.Run("should not report timeouts if a builder fails otherwise", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].Timeout = 50 * time.Millisecond
+		backend.builders[0].ResponseDelay = 200 * time.Millisecond
+		backend.builders[1].Server.Close()
+
+		rr := backend.request(t, []byte(mocks.NewPayloadRequest), from)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+	})
+}
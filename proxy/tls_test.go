@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA is a certificate authority for TLS tests, certificates are written to files in dir
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &testCA{t: t, dir: t.TempDir(), cert: cert, key: key}
+	ca.file = ca.writePEM("ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) writePEM(name, blockType string, der []byte) string {
+	path := filepath.Join(ca.dir, name)
+	require.NoError(ca.t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+// issue creates a certificate for the name and returns the paths of the certificate and key files
+func (ca *testCA) issue(name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(ca.t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(ca.t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(ca.t, err)
+
+	return ca.writePEM(name+".pem", "CERTIFICATE", der), ca.writePEM(name+"-key.pem", "EC PRIVATE KEY", keyDer)
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue("builder.local")
+	clientCert, clientKey := ca.issue("sync-proxy.local")
+
+	// newTLSBuilder starts a mock builder which requires client certificates signed by the test CA
+	newTLSBuilder := func(t *testing.T) *mocks.Server {
+		builder := mocks.NewServer(t)
+		builder.Response = []byte(mocks.NewPayloadResponseValid)
+		builder.Server.Close()
+
+		tlsConfig, err := buildServerTLSConfig(serverCert, serverKey, ca.file)
+		require.NoError(t, err)
+		builder.Server = httptest.NewUnstartedServer(builder.Handler())
+		builder.Server.TLS = tlsConfig
+		builder.Server.StartTLS()
+		t.Cleanup(builder.Server.Close)
+		return builder
+	}
+
+	newService := func(t *testing.T, builder *mocks.Server, tlsConfig *TLSConfig) *ProxyService {
+		builderURL := getURLs(t, []*mocks.Server{builder})[0]
+		service, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			Builders:       []*url.URL{builderURL},
+			BuilderTimeout: time.Second,
+			BuilderConfigs: map[string]*BuilderConfig{builderURL.String(): {TLS: tlsConfig}},
+		})
+		require.NoError(t, err)
+		return service
+	}
+
+	request := func(t *testing.T, service *ProxyService) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		req.RemoteAddr = from
+		rr := httptest.NewRecorder()
+		service.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should connect to builder with mTLS", func(t *testing.T) {
+		builder := newTLSBuilder(t)
+		service := newService(t, builder, &TLSConfig{
+			CAFile:     ca.file,
+			CertFile:   clientCert,
+			KeyFile:    clientKey,
+			ServerName: "builder.local",
+		})
+
+		rr := request(t, service)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, builder.GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should fail without client certificate", func(t *testing.T) {
+		builder := newTLSBuilder(t)
+		service := newService(t, builder, &TLSConfig{CAFile: ca.file, ServerName: "builder.local"})
+
+		rr := request(t, service)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+	})
+
+	t.Run("should fail if the server name doesn't match", func(t *testing.T) {
+		builder := newTLSBuilder(t)
+		service := newService(t, builder, &TLSConfig{
+			CAFile:     ca.file,
+			CertFile:   clientCert,
+			KeyFile:    clientKey,
+			ServerName: "other.local",
+		})
+
+		rr := request(t, service)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+	})
+
+	t.Run("listener should require client certificates", func(t *testing.T) {
+		tlsConfig, err := buildServerTLSConfig(serverCert, serverKey, ca.file)
+		require.NoError(t, err)
+		require.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+
+		_, err = buildServerTLSConfig(serverCert, serverKey, serverKey)
+		require.ErrorIs(t, err, errNoCertificates)
+	})
+}
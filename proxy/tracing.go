@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/flashbots/sync-proxy/engineapi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/flashbots/sync-proxy"
+
+// propagator reads and writes the W3C traceparent header, so traces continue through chained proxies
+var propagator = propagation.TraceContext{}
+
+// NewTracerProvider exports spans to the OTLP HTTP endpoint, e.g. http://localhost:4318
+func NewTracerProvider(ctx context.Context, endpoint, serviceName string, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		// sampled requests from another proxy are traced here as well
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	), nil
+}
+
+// injectTraceContext sets the traceparent header of a request to a builder or proxy
+func injectTraceContext(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// requestAttributes returns the span attributes of a beacon node request
+func requestAttributes(request engineapi.JSONRPCRequest) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", request.Method),
+		attribute.Int("rpc.jsonrpc.request_id", request.ID),
+	}
+
+	switch {
+	case strings.HasPrefix(request.Method, engineapi.NewPayload) && len(request.Params) > 0:
+		if payload, ok := request.Params[0].(*engineapi.ExecutionPayload); ok {
+			attrs = append(attrs,
+				attribute.String("block.hash", payload.BlockHash.Hex()),
+				attribute.Int64("block.number", int64(payload.Number)),
+			)
+		}
+	case strings.HasPrefix(request.Method, engineapi.ForkchoiceUpdated) && len(request.Params) > 0:
+		if raw, ok := request.Params[0].(json.RawMessage); ok {
+			var state engine.ForkchoiceStateV1
+			if err := json.Unmarshal(raw, &state); err == nil {
+				attrs = append(attrs, attribute.String("block.hash", state.HeadBlockHash.Hex()))
+			}
+		}
+	}
+	return attrs
+}
+
+// endSpan records the result of a request and ends the span
+func endSpan(span trace.Span, statusCode int, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if statusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+		if statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(statusCode))
+		}
+	}
+	span.End()
+}
+
+// statusRecorder keeps the status code of a response for the request span
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Unwrap returns the wrapped ResponseWriter, used by http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
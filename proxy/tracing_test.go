@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("should trace requests to builders and proxies", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		builders := createMockServers(t, 2)
+		proxies := createMockServers(t, 1)
+		service, err := NewProxyService(ProxyServiceOpts{
+			Log:            testLog,
+			Builders:       getURLs(t, builders),
+			BuilderTimeout: time.Second,
+			Proxies:        getURLs(t, proxies),
+			ProxyTimeout:   time.Second,
+			TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+		})
+		require.NoError(t, err)
+
+		// the request was traced by a proxy in front of this one
+		traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID := "00f067aa0ba902b7"
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		req.RemoteAddr = from
+		req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+		rr := httptest.NewRecorder()
+		service.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		require.Eventually(t, func() bool { return len(recorder.Ended()) == 4 }, time.Second, 10*time.Millisecond)
+
+		spans := make(map[string][]sdktrace.ReadOnlySpan)
+		for _, span := range recorder.Ended() {
+			require.Equal(t, traceID, span.SpanContext().TraceID().String())
+			spans[span.Name()] = append(spans[span.Name()], span)
+		}
+		require.Len(t, spans["beacon request"], 1)
+		require.Len(t, spans["builder request"], 2)
+		require.Len(t, spans["proxy forward"], 1)
+
+		root := spans["beacon request"][0]
+		require.Equal(t, parentSpanID, root.Parent().SpanID().String())
+		require.Equal(t, trace.SpanKindServer, root.SpanKind())
+		require.Contains(t, root.Attributes(), attribute.String("rpc.method", newPayloadPath))
+		require.Contains(t, root.Attributes(), attribute.Int64("block.number", 1))
+		require.Contains(t, root.Attributes(), attribute.String("block.hash", "0x3559e851470f6e7bbed1db474980683e8c315bfce99b2a6ef47c057c04de7858"))
+		require.Contains(t, root.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+
+		// the builders and proxies continue the trace with the span of their request as parent
+		for _, span := range append(spans["builder request"], spans["proxy forward"]...) {
+			require.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID())
+			require.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+		}
+		builderSpanIDs := []string{
+			spans["builder request"][0].SpanContext().SpanID().String(),
+			spans["builder request"][1].SpanContext().SpanID().String(),
+		}
+		for _, builder := range builders {
+			traceparent := builder.GetLastHeader().Get("traceparent")
+			require.Contains(t, builderSpanIDs, traceparent[36:52])
+			require.Equal(t, traceID, traceparent[3:35])
+		}
+		proxySpanID := spans["proxy forward"][0].SpanContext().SpanID().String()
+		require.Equal(t, "00-"+traceID+"-"+proxySpanID+"-01", proxies[0].GetLastHeader().Get("traceparent"))
+	})
+
+	t.Run("should propagate trace context without tracing", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(mocks.NewPayloadRequest)))
+		require.NoError(t, err)
+		req.RemoteAddr = from
+		traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		req.Header.Set("traceparent", traceparent)
+		rr := httptest.NewRecorder()
+		backend.proxyService.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, traceparent, backend.builders[0].GetLastHeader().Get("traceparent"))
+	})
+}
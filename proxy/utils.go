@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/flashbots/sync-proxy/beacon"
+	"github.com/flashbots/sync-proxy/compression"
+)
+
+// BuildProxyRequest copies the request of the beacon node with the given body, to be sent to a backend. The address
+// of the previous hop, the beacon node or a proxy in front of this one, is appended to X-Forwarded-For.
+func BuildProxyRequest(req *http.Request, bodyBytes []byte) *http.Request {
+	proxyReq := req.Clone(context.Background())
+	appendHostToXForwardHeader(proxyReq.Header, beacon.RemoteAddrHost(req.RemoteAddr))
+	proxyReq.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	proxyReq.ContentLength = int64(len(bodyBytes))
+	return proxyReq
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vv := range src {
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
+
+func appendHostToXForwardHeader(header http.Header, host string) {
+	if host == "" {
+		return
+	}
+
+	// X-Forwarded-For information to indicate it is forwarded from a BN
+	if prior, ok := header["X-Forwarded-For"]; ok {
+		host = strings.Join(prior, ", ") + ", " + host
+	}
+	header.Set("X-Forwarded-For", host)
+}
+
+// getVia returns the instance ids of the proxies the request passed through
+func getVia(header http.Header) []string {
+	var ids []string
+	for _, value := range header.Values(viaHeader) {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func hasVia(header http.Header, instanceID string) bool {
+	for _, id := range getVia(header) {
+		if id == instanceID {
+			return true
+		}
+	}
+	return false
+}
+
+func appendVia(header http.Header, instanceID string) {
+	header.Set(viaHeader, strings.Join(append(getVia(header), instanceID), ", "))
+}
+
+func randomInstanceID() string {
+	id := make([]byte, 8)
+	rand.Read(id) //nolint:errcheck
+	return hex.EncodeToString(id)
+}
+
+// getResponseBody returns the uncompressed body of a buffered builder response
+func getResponseBody(response BuilderResponse) []byte {
+	body, err := compression.Decode(response.Header.Get("Content-Encoding"), response.Body)
+	if err != nil {
+		return response.Body
+	}
+	return body
+}
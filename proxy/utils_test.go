@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/flashbots/sync-proxy/beacon"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildProxyRequestForwardedFor(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "172.16.0.5:1234"
+	proxyReq := BuildProxyRequest(req, nil)
+	require.Equal(t, "172.16.0.5", proxyReq.Header.Get("X-Forwarded-For"))
+
+	// the next proxy trusts this one and gets the same client
+	proxyReq.RemoteAddr = "10.0.0.1:4321"
+	trusted, err := beacon.ParseIPList("10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "172.16.0.5", beacon.RemoteHost(proxyReq, trusted))
+
+	req.RemoteAddr = "[2001:db8::5]:1234"
+	proxyReq = BuildProxyRequest(req, nil)
+	require.Equal(t, "2001:db8::5", proxyReq.Header.Get("X-Forwarded-For"))
+}
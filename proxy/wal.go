@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// walRecord is a single line in the write-ahead log, either a queued request or the ack of a delivered one
+type walRecord struct {
+	Item *queueItem `json:"item,omitempty"`
+	Ack  uint64     `json:"ack,omitempty"`
+}
+
+// wal is an append-only log of the requests queued for a builder, used to restore the queue after a restart
+type wal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// openWAL opens the log at path and returns the requests which were queued but not delivered yet
+func openWAL(path string) (*wal, []*queueItem, error) {
+	items, err := readWAL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &wal{path: path}
+	// rewrite the log with only the pending items so acked records don't accumulate
+	if err := w.rewrite(items); err != nil {
+		return nil, nil, err
+	}
+	return w, items, nil
+}
+
+func readWAL(path string) ([]*queueItem, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []*queueItem
+	acked := make(map[uint64]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var record walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// a partially written last line after a crash, everything before it is valid
+			break
+		}
+		if record.Item != nil {
+			items = append(items, record.Item)
+		} else {
+			acked[record.Ack] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	pending := items[:0]
+	for _, item := range items {
+		if !acked[item.Seq] {
+			pending = append(pending, item)
+		}
+	}
+	return pending, nil
+}
+
+func (w *wal) rewrite(items []*queueItem) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tmpPath := w.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(tmp)
+	for _, item := range items {
+		if err := enc.Encode(walRecord{Item: item}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		return err
+	}
+
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file, err = os.OpenFile(w.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	return err
+}
+
+// write appends the records to the log and syncs it to disk
+func (w *wal) write(records []walRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	enc := json.NewEncoder(w.file)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return w.file.Sync()
+}
+
+// truncate empties the log, used when the queue is drained
+func (w *wal) truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Truncate(0)
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/flashbots/sync-proxy/beacon"
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// serveWebSocket reads JSON-RPC requests from a WebSocket connection and sends them through the same
+// handler as HTTP requests, including the middlewares. Each connection is identified as its own beacon node.
+func (p *ProxyService) serveWebSocket(w http.ResponseWriter, req *http.Request) {
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		p.log.WithError(err).Error("failed to upgrade WebSocket connection")
+		return
+	}
+	defer conn.Close()
+
+	remoteHost := fmt.Sprintf("%s/ws-%d", beacon.RemoteHost(req, p.trustedProxies), p.numWebSocketConns.Add(1))
+	log := p.log.WithField("remoteHost", remoteHost)
+	log.Info("WebSocket connection opened")
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.WithError(err).Warn("WebSocket connection closed")
+			} else {
+				log.Info("WebSocket connection closed")
+			}
+			return
+		}
+		if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+			continue
+		}
+
+		// requests are handled in order, so payloads are sent to the builders in the order they were received
+		response := p.handleWebSocketRequest(req, remoteHost, data)
+		if err := conn.WriteMessage(websocket.TextMessage, response); err != nil {
+			log.WithError(err).Warn("failed to write WebSocket response")
+			return
+		}
+	}
+}
+
+// handleWebSocketRequest sends a WebSocket message through the handler of HTTP requests as a request of its own
+// and turns the HTTP response into the JSON-RPC response of the message
+func (p *ProxyService) handleWebSocketRequest(upgradeReq *http.Request, remoteHost string, data []byte) []byte {
+	if !json.Valid(data) {
+		return engineapi.NewJSONRPCError(nil, engineapi.CodeParseError, "invalid JSON")
+	}
+	if err := p.checkRateLimit(upgradeReq); err != nil {
+		var msg struct {
+			ID any `json:"id"`
+		}
+		json.Unmarshal(data, &msg) //nolint:errcheck
+		return engineapi.NewJSONRPCError(msg.ID, engineapi.CodeServerError, err.Error())
+	}
+
+	req, err := p.buildWebSocketBuilderRequest(upgradeReq.Context(), upgradeReq)
+	if err != nil {
+		return engineapi.NewJSONRPCError(nil, engineapi.CodeInternalError, err.Error())
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+
+	w := &responseBuffer{header: http.Header{}}
+	r := &Request{HTTP: req, RemoteHost: remoteHost, WebSocket: true}
+	p.handler(w, r)
+
+	body := bytes.TrimSpace(w.body.Bytes())
+	switch {
+	case w.statusCode != 0 && w.statusCode != http.StatusOK:
+		message := string(body)
+		if message == "" {
+			message = http.StatusText(w.statusCode)
+		}
+		return engineapi.NewJSONRPCError(r.JSON.ID, engineapi.CodeInternalError, message)
+	case len(body) == 0:
+		// filtered requests are answered without body
+		return engineapi.NewJSONRPCError(r.JSON.ID, engineapi.CodeServerError, errRequestFiltered.Error())
+	}
+	return matchResponseID(body, r.JSON.ID)
+}
+
+// buildWebSocketBuilderRequest creates the HTTP request to the builders for a WebSocket message. The JWT
+// of the handshake expires, so a fresh one is signed for each request if the proxy has the JWT secret.
+func (p *ProxyService) buildWebSocketBuilderRequest(ctx context.Context, upgradeReq *http.Request) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.RemoteAddr = upgradeReq.RemoteAddr
+	req.Header.Set("Content-Type", "application/json")
+	for _, key := range []string{"X-Forwarded-For", "X-Real-Ip", viaHeader} {
+		if values := upgradeReq.Header.Values(key); len(values) > 0 {
+			req.Header[key] = values
+		}
+	}
+
+	if p.jwtSecret != nil {
+		token, err := newJWT(p.jwtSecret)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if auth := upgradeReq.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return req, nil
+}
+
+// matchResponseID makes sure the response has the id of the request it is sent for
+func matchResponseID(response []byte, id int) []byte {
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(response, &msg); err != nil {
+		return response
+	}
+
+	var responseID int
+	if err := json.Unmarshal(msg["id"], &responseID); err == nil && responseID == id {
+		return response
+	}
+
+	msg["id"], _ = json.Marshal(id)
+	matched, err := json.Marshal(msg)
+	if err != nil {
+		return response
+	}
+	return matched
+}
+
+func newJWT(secret []byte) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["iat"] = jwt.TimeFunc().Unix()
+	return token.SignedString(secret)
+}
+
+// LoadJWTSecret reads a hex encoded JWT secret file, as used by the execution clients
+func LoadJWTSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex secret in %s: %w", path, err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flashbots/sync-proxy/engineapi"
+	"github.com/flashbots/sync-proxy/mocks"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func dialWebSocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func webSocketRequest(t *testing.T, conn *websocket.Conn, payload string) []byte {
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(payload)))
+	_, response, err := conn.ReadMessage()
+	require.NoError(t, err)
+	return response
+}
+
+func TestWebSocket(t *testing.T) {
+	t.Run("should send requests from WebSocket connection to builders", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		conn := dialWebSocket(t, server)
+		response := webSocketRequest(t, conn, mocks.NewPayloadRequest)
+		require.Equal(t, mocks.NewPayloadResponseValid, string(response))
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+		require.Equal(t, 1, backend.builders[1].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should fall back to another builder if the primary response fails", func(t *testing.T) {
+		backend := newTestBackend(t, 2, 0, time.Second, time.Second)
+		backend.proxyService.builderEntries[0].MaxResponseSize = 64 << 10
+		backend.builders[0].Response = []byte(strings.Repeat(" ", 128<<10))
+		backend.builders[1].Response = []byte(mocks.NewPayloadResponseSyncing)
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		conn := dialWebSocket(t, server)
+		response := webSocketRequest(t, conn, mocks.NewPayloadRequest)
+		require.Equal(t, mocks.NewPayloadResponseSyncing, string(response))
+		// the connection is still open
+		response = webSocketRequest(t, conn, mocks.NewPayloadRequest)
+		require.Equal(t, mocks.NewPayloadResponseSyncing, string(response))
+	})
+
+	t.Run("should answer filtered requests with JSON-RPC error", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		conn := dialWebSocket(t, server)
+		response := webSocketRequest(t, conn, mocks.EthChainIDRequest)
+
+		var errorResponse engineapi.JSONRPCErrorResponse
+		require.NoError(t, json.Unmarshal(response, &errorResponse))
+		require.NotNil(t, errorResponse.Error)
+		require.Equal(t, engineapi.CodeServerError, errorResponse.Error.Code)
+		require.InDelta(t, 1, errorResponse.ID, 0)
+	})
+
+	t.Run("each connection should be a separate beacon node", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.builders[0].Response = []byte(mocks.ForkchoiceResponse)
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		first := dialWebSocket(t, server)
+		second := dialWebSocket(t, server)
+
+		response := webSocketRequest(t, first, mocks.ForkchoiceRequest)
+		require.Equal(t, mocks.ForkchoiceResponse, string(response))
+
+		// second connection comes from the same host but is not the beacon node the proxy is synced to
+		response = webSocketRequest(t, second, mocks.ForkchoiceRequest)
+		var errorResponse engineapi.JSONRPCErrorResponse
+		require.NoError(t, json.Unmarshal(response, &errorResponse))
+		require.NotNil(t, errorResponse.Error)
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(forkchoicePath))
+	})
+
+	t.Run("should send requests through the middlewares", func(t *testing.T) {
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		var methods []string
+		record := func(next Handler) Handler {
+			return func(w http.ResponseWriter, r *Request) {
+				methods = append(methods, r.JSON.Method)
+				next(w, r)
+			}
+		}
+		backend.proxyService.handler = backend.proxyService.chain(nil, []Middleware{record})
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		conn := dialWebSocket(t, server)
+		response := webSocketRequest(t, conn, mocks.NewPayloadRequest)
+		require.Equal(t, mocks.NewPayloadResponseValid, string(response))
+		require.Equal(t, []string{newPayloadPath}, methods)
+
+		// the via header of the connection is checked for loops
+		header := http.Header{}
+		header.Set(viaHeader, backend.proxyService.instanceID)
+		looped, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+		require.NoError(t, err)
+		resp.Body.Close()
+		defer looped.Close()
+		var errorResponse engineapi.JSONRPCErrorResponse
+		require.NoError(t, json.Unmarshal(webSocketRequest(t, looped, mocks.NewPayloadRequest), &errorResponse))
+		require.NotNil(t, errorResponse.Error)
+		require.Equal(t, 1, backend.builders[0].GetRequestCount(newPayloadPath))
+	})
+
+	t.Run("should sign fresh JWTs for builder requests", func(t *testing.T) {
+		secret := []byte("0123456789abcdef0123456789abcdef")
+		path := filepath.Join(t.TempDir(), "jwt.hex")
+		require.NoError(t, os.WriteFile(path, []byte("0x"+hex.EncodeToString(secret)+"\n"), 0o600))
+		loaded, err := LoadJWTSecret(path)
+		require.NoError(t, err)
+		require.Equal(t, secret, loaded)
+
+		backend := newTestBackend(t, 1, 0, time.Second, time.Second)
+		backend.proxyService.jwtSecret = loaded
+		server := httptest.NewServer(backend.proxyService)
+		defer server.Close()
+
+		conn := dialWebSocket(t, server)
+		webSocketRequest(t, conn, mocks.NewPayloadRequest)
+
+		auth := backend.builders[0].GetLastHeader().Get("Authorization")
+		require.True(t, strings.HasPrefix(auth, "Bearer "))
+		token, err := jwt.Parse(strings.TrimPrefix(auth, "Bearer "), func(*jwt.Token) (any, error) { return secret, nil })
+		require.NoError(t, err)
+		require.True(t, token.Valid)
+	})
+}
+
+func TestMatchResponseID(t *testing.T) {
+	require.Equal(t, mocks.NewPayloadResponseValid, string(matchResponseID([]byte(mocks.NewPayloadResponseValid), 67)))
+
+	var response engineapi.JSONRPCResponse
+	require.NoError(t, json.Unmarshal(matchResponseID([]byte(mocks.NewPayloadResponseValid), 5), &response))
+	require.Equal(t, 5, response.ID)
+}